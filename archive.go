@@ -0,0 +1,112 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Entrada de un zip/tar con hasta maxBytes de contenido ya leídos
+type archiveEntry struct {
+	Name    string
+	Size    int64
+	ModTime time.Time
+	Preview string
+}
+
+// Contenedores que -archives abre en lugar de tratarlos como archivo
+func isArchive(name string) bool {
+	n := strings.ToLower(name)
+	for _, suf := range []string{".zip", ".tar", ".tar.gz", ".tgz"} {
+		if strings.HasSuffix(n, suf) {
+			return true
+		}
+	}
+	return false
+}
+
+// Nombres de entrada que no salen del comprimido: "../x" o "/etc/x" acaban
+// en rutas del índice y, con -per-file-out, en rutas de escritura
+func localEntry(name string) bool {
+	return filepath.IsLocal(filepath.FromSlash(name))
+}
+
+// Recorre las entradas regulares de un zip/tar(.gz) cuya extensión está
+// en exts y llama a fn con cada una
+func walkArchive(p string, exts map[string]bool, maxBytes int, fn func(archiveEntry) error) error {
+	if strings.HasSuffix(strings.ToLower(p), ".zip") {
+		return walkZip(p, exts, maxBytes, fn)
+	}
+	return walkTar(p, exts, maxBytes, fn)
+}
+
+func walkZip(p string, exts map[string]bool, maxBytes int, fn func(archiveEntry) error) error {
+	r, err := zip.OpenReader(p)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	for _, f := range r.File {
+		if !f.Mode().IsRegular() || !exts[strings.ToLower(path.Ext(f.Name))] || !localEntry(f.Name) {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		b, err := io.ReadAll(io.LimitReader(rc, int64(maxBytes)))
+		rc.Close()
+		if err != nil {
+			return err
+		}
+		e := archiveEntry{Name: f.Name, Size: int64(f.UncompressedSize64), ModTime: f.Modified, Preview: string(b)}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func walkTar(p string, exts map[string]bool, maxBytes int, fn func(archiveEntry) error) error {
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if n := strings.ToLower(p); strings.HasSuffix(n, ".gz") || strings.HasSuffix(n, ".tgz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if h.Typeflag != tar.TypeReg || !exts[strings.ToLower(path.Ext(h.Name))] || !localEntry(h.Name) {
+			continue
+		}
+		b, err := io.ReadAll(io.LimitReader(tr, int64(maxBytes)))
+		if err != nil {
+			return err
+		}
+		e := archiveEntry{Name: strings.TrimPrefix(h.Name, "./"), Size: h.Size, ModTime: h.ModTime, Preview: string(b)}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// Registro JSONL de lo enviado al proveedor (-audit-prompts), una línea
+// por petición. Se abre en modo append: varias ejecuciones
+// pueden compartir el mismo archivo.
+type auditLog struct {
+	mu  sync.Mutex
+	f   *os.File
+	enc *json.Encoder
+}
+
+type auditEntry struct {
+	Time    time.Time `json:"time"`
+	Path    string    `json:"path"`
+	Model   string    `json:"model"`
+	Target  string    `json:"target"` // URL o comando
+	Hash    string    `json:"prompt_hash"`
+	Request string    `json:"request"` // cuerpo completo de la petición
+}
+
+func openAuditLog(path string) (*auditLog, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &auditLog{f: f, enc: json.NewEncoder(f)}, nil
+}
+
+// Anota e y, si se registró, deja su hash en dst (puede ser nil). Con
+// -compare-models varias llamadas comparten dst, de ahí el lock.
+func (a *auditLog) record(e auditEntry, dst *string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := a.enc.Encode(e); err != nil {
+		return err
+	}
+	if dst != nil {
+		*dst = e.Hash
+	}
+	return nil
+}
+
+func (a *auditLog) Close() error { return a.f.Close() }
+
+// "sha256:<hex>" de la petición, el mismo en el log y en IndexItem.PromptHash
+func promptHash(p string) string {
+	h := sha256.Sum256([]byte(p))
+	return "sha256:" + hex.EncodeToString(h[:])
+}
+
+type promptHashKey struct{}
+
+// El indexer pasa en el contexto dónde guardar el hash del prompt de su
+// ítem: un duplicado que resuelve -dedup no envía nada y queda sin hash
+func withPromptHash(ctx context.Context, dst *string) context.Context {
+	return context.WithValue(ctx, promptHashKey{}, dst)
+}
+
+type auditKey struct{}
+
+// Log, ruta y modelo de la llamada en curso, para auditRequest
+type auditCall struct {
+	log         *auditLog
+	path, model string
+}
+
+// Anota body justo antes de mandarlo a target, si la llamada va auditada.
+// Lo llaman postJSON y el proveedor exec, así que queda cada petición real
+// tal cual sale (mensaje de sistema, reintentos y -reprompt incluidos) y
+// nada de lo que resuelven dedup, caché o el presupuesto. Si no se puede
+// registrar, no se manda.
+func auditRequest(ctx context.Context, target string, body []byte) error {
+	c, ok := ctx.Value(auditKey{}).(*auditCall)
+	if !ok {
+		return nil
+	}
+	e := auditEntry{Time: time.Now().UTC(), Path: c.path, Model: c.model, Target: target, Hash: promptHash(string(body)), Request: string(body)}
+	dst, _ := ctx.Value(promptHashKey{}).(*string)
+	return c.log.record(e, dst)
+}
+
+// Marca las llamadas que pasan por él para que auditRequest las anote
+type auditSummarizer struct {
+	next Summarizer
+	log  *auditLog
+}
+
+func (a *auditSummarizer) Summarize(ctx context.Context, model, filename, preview string) (string, []string, error) {
+	ctx = context.WithValue(ctx, auditKey{}, &auditCall{a.log, filename, model})
+	return a.next.Summarize(ctx, model, filename, preview)
+}
+
+func (a *auditSummarizer) Unwrap() Summarizer { return a.next }
+
+// Lo mismo para -embed-model: el texto embebido también sale. La ruta la
+// pone el indexer con withAuditPath.
+type auditEmbedder struct {
+	next Embedder
+	log  *auditLog
+}
+
+func (a *auditEmbedder) Embed(ctx context.Context, model, text string) ([]float32, error) {
+	path, _ := ctx.Value(auditPathKey{}).(string)
+	ctx = context.WithValue(ctx, auditKey{}, &auditCall{a.log, path, model})
+	return a.next.Embed(ctx, model, text)
+}
+
+type auditPathKey struct{}
+
+func withAuditPath(ctx context.Context, path string) context.Context {
+	return context.WithValue(ctx, auditPathKey{}, path)
+}
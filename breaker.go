@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// El proveedor sigue fallando tras la pausa: no se le llama más
+var ErrCircuitOpen = errors.New("proveedor caído (circuito abierto)")
+
+// Circuit breaker para caídas del proveedor (-breaker-failures): tras n
+// fallos seguidos deja de llamar durante cooldown, luego deja pasar una
+// sola llamada de prueba. Si la prueba falla, el circuito queda abierto
+// para el resto de la ejecución.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	cond      *sync.Cond
+	n         int
+	cooldown  time.Duration
+	fails     int
+	openUntil time.Time // pausa en curso
+	probing   bool      // hay una llamada de prueba en vuelo
+	tripped   bool
+}
+
+func newCircuitBreaker(n int, cooldown time.Duration) *circuitBreaker {
+	b := &circuitBreaker{n: n, cooldown: cooldown}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+// Espera a que se pueda llamar al proveedor; ErrCircuitOpen si ya no
+func (b *circuitBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for {
+		switch {
+		case b.tripped:
+			return ErrCircuitOpen
+		case b.probing:
+			b.cond.Wait()
+		case b.openUntil.IsZero():
+			return nil
+		case time.Now().Before(b.openUntil):
+			d := time.Until(b.openUntil)
+			b.mu.Unlock()
+			time.Sleep(d)
+			b.mu.Lock()
+		default:
+			// Fin de la pausa: esta llamada es la prueba
+			b.openUntil = time.Time{}
+			b.probing = true
+			return nil
+		}
+	}
+}
+
+// Anota el resultado de una llamada permitida por allow
+func (b *circuitBreaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	failed := providerFailure(err)
+	if b.probing {
+		b.probing = false
+		b.tripped = failed
+		if failed {
+			fmt.Fprintln(os.Stderr, "circuito abierto: el proveedor sigue fallando tras la pausa, no se llamará más:", err)
+		}
+		b.fails = 0
+		b.cond.Broadcast()
+		return
+	}
+	if !failed {
+		b.fails = 0
+		return
+	}
+	b.fails++
+	if b.fails >= b.n && b.openUntil.IsZero() {
+		fmt.Fprintf(os.Stderr, "circuito abierto: %d fallos seguidos, pausa de %s: %v\n", b.fails, b.cooldown, err)
+		b.openUntil = time.Now().Add(b.cooldown)
+	}
+}
+
+// Fallos que apuntan al proveedor (caída, red, rate limit), no al archivo
+func providerFailure(err error) bool {
+	return err != nil && !errors.Is(err, ErrParse) && !errors.Is(err, ErrBudgetExhausted) && !errors.Is(err, ErrCircuitOpen)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+)
+
+// Presupuesto de tokens agotado (-max-tokens-total): no es un fallo del
+// archivo, el ítem queda con una nota
+var ErrBudgetExhausted = errors.New("presupuesto de tokens agotado")
+
+// Tokens de s según el tokenizer del modelo (heurística si no se conoce)
+func estimateTokens(model, s string) int64 {
+	return int64(tokenizerFor(model).CountTokens(s))
+}
+
+// Summarizer que acumula tokens estimados (prompt + respuesta) y deja de
+// llamar al siguiente cuando se alcanza el máximo (max 0 = solo contar). Con varios workers
+// puede pasarse por las llamadas que ya estaban en vuelo.
+type budgetSummarizer struct {
+	next Summarizer
+	max  int64
+	used *atomic.Int64 // compartido entre rutas
+}
+
+func (b *budgetSummarizer) Summarize(ctx context.Context, model, filename, preview string) (string, []string, error) {
+	if b.max > 0 && b.used.Load() >= b.max {
+		return "", nil, ErrBudgetExhausted
+	}
+	sum, kws, err := b.next.Summarize(ctx, model, filename, preview)
+	b.used.Add(estimateTokens(model, prompt(ctx, filename, preview)) + estimateTokens(model, sum+strings.Join(kws, " ")))
+	return sum, kws, err
+}
+
+func (b *budgetSummarizer) Unwrap() Summarizer { return b.next }
+
+// Lo mismo para -embed-model: los tokens del texto embebido cuentan para
+// -max-tokens-total
+type budgetEmbedder struct {
+	next Embedder
+	max  int64
+	used *atomic.Int64
+}
+
+func (b *budgetEmbedder) Embed(ctx context.Context, model, text string) ([]float32, error) {
+	if b.max > 0 && b.used.Load() >= b.max {
+		return nil, ErrBudgetExhausted
+	}
+	vec, err := b.next.Embed(ctx, model, text)
+	b.used.Add(estimateTokens(model, text))
+	return vec, err
+}
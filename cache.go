@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Caché en disco de resúmenes entre ejecuciones (-cache-dir). La clave es
+// solo el contenido (más modelo y opciones del prompt), no la ruta: un
+// archivo idéntico en otro proyecto o en otra ejecución reutiliza el
+// resumen. Los errores no se guardan.
+type cacheSummarizer struct {
+	next Summarizer
+	dir  string
+}
+
+type cacheEntry struct {
+	Summary  string   `json:"summary"`
+	Keywords []string `json:"keywords"`
+}
+
+func (c *cacheSummarizer) Summarize(ctx context.Context, model, filename, preview string) (string, []string, error) {
+	key := contentKey(model+"\x00"+fmt.Sprint(promptOpts)+"\x00"+langInstruction(ctx), preview)
+	path := filepath.Join(c.dir, key[:2], key+".json")
+	if b, err := os.ReadFile(path); err == nil {
+		var e cacheEntry
+		if json.Unmarshal(b, &e) == nil {
+			metrics.CacheHits.Add(1)
+			return e.Summary, e.Keywords, nil
+		}
+	}
+	sum, kws, err := c.next.Summarize(ctx, model, filename, preview)
+	if err == nil {
+		// Sin poder escribir la caché se sigue igual: solo se pierde reutilización
+		if e := c.store(path, cacheEntry{sum, kws}); e != nil {
+			fmt.Fprintln(os.Stderr, "cache:", e)
+		}
+	}
+	return sum, kws, err
+}
+
+func (c *cacheSummarizer) Unwrap() Summarizer { return c.next }
+
+// Escritura atómica: dos ejecuciones a la vez nunca leen una entrada a medias
+func (c *cacheSummarizer) store(path string, e cacheEntry) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := writeTemp(path, e)
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
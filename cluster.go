@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Palabras por shingle al comparar resúmenes
+const shingleSize = 3
+
+// Marca con el mismo Cluster ("c1", "c2"...) los ítems cuyos resúmenes se
+// parecen al menos threshold (Jaccard de shingles de palabras). Los ítems
+// sin parecidos quedan sin cluster. Compara todos con todos: pensado para
+// índices de miles de ítems, no de millones.
+func clusterSummaries(items []IndexItem, threshold float64) {
+	sets := make([]map[string]bool, len(items))
+	for i, it := range items {
+		sets[i] = shingles(it.Summary)
+	}
+	parent := make([]int, len(items))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	for i := range items {
+		if len(sets[i]) == 0 {
+			continue
+		}
+		for j := i + 1; j < len(items); j++ {
+			if len(sets[j]) > 0 && jaccard(sets[i], sets[j]) >= threshold {
+				parent[find(j)] = find(i)
+			}
+		}
+	}
+
+	size := map[int]int{}
+	for i := range items {
+		size[find(i)]++
+	}
+	ids := map[int]string{} // numerados en orden de aparición
+	for i := range items {
+		r := find(i)
+		items[i].Cluster = "" // el de un índice previo ya no vale
+		if size[r] < 2 {
+			continue
+		}
+		if ids[r] == "" {
+			ids[r] = fmt.Sprintf("c%d", len(ids)+1)
+		}
+		items[i].Cluster = ids[r]
+	}
+}
+
+func shingles(s string) map[string]bool {
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	n := min(shingleSize, len(words))
+	set := map[string]bool{}
+	for i := 0; n > 0 && i+n <= len(words); i++ {
+		set[strings.Join(words[i:i+n], " ")] = true
+	}
+	return set
+}
+
+func jaccard(a, b map[string]bool) float64 {
+	inter := 0
+	for k := range a {
+		if b[k] {
+			inter++
+		}
+	}
+	return float64(inter) / float64(len(a)+len(b)-inter)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Resultado de un modelo en modo -compare-models
+type Alternative struct {
+	Model      string   `json:"model"`
+	Summary    string   `json:"summary"`
+	Keywords   []string `json:"keywords"`
+	Error      string   `json:"error,omitempty"`
+	DurationMs int64    `json:"duration_ms"`
+	Chosen     bool     `json:"chosen,omitempty"`
+
+	err error // el de Error, con su tipo (para el breaker y ErrAuth)
+}
+
+// Resume el mismo preview con cada modelo (en paralelo) y marca como
+// elegida la alternativa con mejor puntuación; en empate gana la primera.
+func compareModels(ctx context.Context, s Summarizer, models []string, filename, preview string) []Alternative {
+	alts := make([]Alternative, len(models))
+	var wg sync.WaitGroup
+	for i, m := range models {
+		wg.Add(1)
+		go func(i int, m string) {
+			defer wg.Done()
+			start := time.Now()
+			sum, kws, err := s.Summarize(ctx, m, filename, preview)
+			alts[i] = Alternative{Model: m, Summary: sum, Keywords: kws, DurationMs: time.Since(start).Milliseconds()}
+			if err != nil {
+				alts[i].Error, alts[i].err = err.Error(), err
+			}
+		}(i, m)
+	}
+	wg.Wait()
+
+	best := 0
+	for i := range alts {
+		if altScore(alts[i]) > altScore(alts[best]) {
+			best = i
+		}
+	}
+	alts[best].Chosen = true
+	return alts
+}
+
+// Heurística simple: resumen dentro de 40-80 palabras y 5-10 keywords
+// suman más que salidas fuera de rango; con error no compite.
+func altScore(a Alternative) int {
+	if a.Error != "" {
+		return -1
+	}
+	score := 0
+	switch n := len(strings.Fields(a.Summary)); {
+	case n >= 40 && n <= 80:
+		score += 2
+	case n > 0:
+		score++
+	}
+	switch k := len(a.Keywords); {
+	case k >= 5 && k <= 10:
+		score += 2
+	case k > 0:
+		score++
+	}
+	return score
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+)
+
+// Comparte una sola llamada al LLM entre archivos con el mismo contenido
+// dentro de una ejecución (plantillas, archivos generados). Las llamadas
+// en vuelo se comparten al estilo singleflight; los resultados con error
+// no se guardan para que el siguiente duplicado lo reintente.
+type dedupSummarizer struct {
+	next Summarizer
+
+	mu    sync.Mutex
+	calls map[string]*dedupCall
+}
+
+type dedupCall struct {
+	done     chan struct{}
+	summary  string
+	keywords []string
+	err      error
+}
+
+func newDedupSummarizer(next Summarizer) *dedupSummarizer {
+	return &dedupSummarizer{next: next, calls: map[string]*dedupCall{}}
+}
+
+func (d *dedupSummarizer) Summarize(ctx context.Context, model, filename, preview string) (string, []string, error) {
+	key := contentKey(model, preview)
+
+	d.mu.Lock()
+	if c, ok := d.calls[key]; ok {
+		d.mu.Unlock()
+		select {
+		case <-c.done:
+			if c.err == nil {
+				metrics.DedupHits.Add(1)
+			}
+			return c.summary, append([]string(nil), c.keywords...), c.err
+		case <-ctx.Done():
+			return "", nil, ctx.Err()
+		}
+	}
+	c := &dedupCall{done: make(chan struct{})}
+	d.calls[key] = c
+	d.mu.Unlock()
+
+	c.summary, c.keywords, c.err = d.next.Summarize(ctx, model, filename, preview)
+	if c.err != nil {
+		d.mu.Lock()
+		delete(d.calls, key)
+		d.mu.Unlock()
+	}
+	close(c.done)
+	return c.summary, c.keywords, c.err
+}
+
+func (d *dedupSummarizer) Unwrap() Summarizer { return d.next }
+
+// Hash del contenido (y el modelo) que identifica previews idénticos
+func contentKey(model, preview string) string {
+	h := sha256.New()
+	h.Write([]byte(model))
+	h.Write([]byte{0})
+	h.Write([]byte(preview))
+	return hex.EncodeToString(h.Sum(nil))
+}
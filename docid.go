@@ -0,0 +1,30 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+)
+
+// Id estable de un documento (-doc-id): "content" es el hash del archivo
+// completo, así sigue siendo el mismo tras un renombrado o un movimiento;
+// "path" el de la ruta relativa, estable mientras el archivo no se mueva
+// aunque cambie su contenido
+func docID(scheme, path, rel string) (string, error) {
+	h := sha256.New()
+	switch scheme {
+	case "content":
+		f, err := os.Open(path)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		if _, err := io.Copy(h, f); err != nil {
+			return "", err
+		}
+	case "path":
+		io.WriteString(h, rel)
+	}
+	return hex.EncodeToString(h.Sum(nil)[:16]), nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Texto fijo y corto para el subcomando doctor
+const doctorPreview = "Go es un lenguaje de programación compilado y concurrente creado en Google. Este archivo es una prueba de conectividad del indexador."
+
+// Subcomando "doctor": una llamada mínima al summarizer configurado para
+// comprobar conexión, credenciales y que la respuesta es JSON parseable
+func runDoctor(s Summarizer, provider, model string, timeout time.Duration) error {
+	fmt.Println("proveedor:", provider)
+	fmt.Println("modelo:   ", model)
+	if _, ok := s.(NoopSummarizer); ok {
+		return errors.New("sin proveedor utilizable (LLM_API_KEY vacío)")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	start := time.Now()
+	sum, kws, err := s.Summarize(ctx, model, "doctor.txt", doctorPreview)
+	fmt.Println("tiempo:   ", time.Since(start).Round(time.Millisecond))
+	switch {
+	case errors.Is(err, ErrParse):
+		fmt.Println("JSON:      no parseable")
+		return err
+	case err != nil:
+		fmt.Println("JSON:      -")
+		return fmt.Errorf("%s: %w", errorKind(err), err)
+	}
+	fmt.Printf("JSON:      OK (summary de %d caracteres, %d keywords)\n", len([]rune(sum)), len(kws))
+	return nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Proveedores que además de resumir calculan embeddings (-embed-model)
+type Embedder interface {
+	Embed(ctx context.Context, model, text string) ([]float32, error)
+}
+
+// Mismo recorte que el prompt: los embeddings se calculan sobre lo que
+// ve el modelo que resume
+func embedInput(preview string) string {
+	if len(preview) > 6000 {
+		preview = trimPartialRune(preview[:6000])
+	}
+	return preview
+}
+
+func (c *OpenAICompat) Embed(ctx context.Context, model, text string) ([]float32, error) {
+	var out struct {
+		Data []struct {
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	body := map[string]any{"model": model, "input": embedInput(text)}
+	if err := postJSON(ctx, strings.TrimRight(c.Base, "/")+"/v1/embeddings", c.header(), body, &out); err != nil {
+		return nil, err
+	}
+	if len(out.Data) == 0 {
+		return nil, fmt.Errorf("%w: embeddings sin data", ErrParse)
+	}
+	return out.Data[0].Embedding, nil
+}
+
+func (o *OllamaSummarizer) Embed(ctx context.Context, model, text string) ([]float32, error) {
+	var out struct {
+		Embeddings [][]float32 `json:"embeddings"`
+	}
+	body := map[string]any{"model": model, "input": embedInput(text)}
+	if o.KeepAlive != "" {
+		body["keep_alive"] = o.KeepAlive
+	}
+	if err := postJSON(ctx, strings.TrimRight(o.Base, "/")+"/api/embed", nil, body, &out); err != nil {
+		return nil, err
+	}
+	if len(out.Embeddings) == 0 {
+		return nil, fmt.Errorf("%w: embeddings vacío", ErrParse)
+	}
+	return out.Embeddings[0], nil
+}
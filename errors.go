@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// Categorías de fallo de los summarizers. Se envuelven con %w para que
+// el llamador pueda distinguirlas con errors.Is (reintentos, métricas,
+// abortar ante credenciales inválidas...).
+var (
+	ErrRateLimited = errors.New("rate limit")
+	ErrAuth        = errors.New("autenticación rechazada")
+	ErrParse       = errors.New("respuesta no parseable")
+	ErrTimeout     = errors.New("timeout")
+	// Preview binario o con otra codificación (sin -latin1-fallback)
+	ErrInvalidUTF8 = errors.New("not valid UTF-8")
+	// 200 con el cuerpo o el texto del modelo vacíos: no es JSON roto, suele
+	// ser pasajero y se reintenta
+	ErrEmptyResponse = errors.New("empty response from provider")
+)
+
+func (e *httpError) Unwrap() error {
+	switch {
+	case e.Status == 401 || e.Status == 403:
+		return ErrAuth
+	case e.Status == 429:
+		return ErrRateLimited
+	}
+	return nil
+}
+
+// Marca como ErrTimeout los vencimientos de contexto y timeouts de red
+func wrapTimeout(err error) error {
+	var ne net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &ne) && ne.Timeout()) {
+		return fmt.Errorf("%w: %w", ErrTimeout, err)
+	}
+	return err
+}
+
+// Nombre estable de la categoría de un error para IndexItem.ErrorKind
+func errorKind(err error) string {
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, ErrAuth):
+		return "auth"
+	case errors.Is(err, ErrRateLimited):
+		return "rate_limit"
+	case errors.Is(err, ErrTimeout):
+		return "timeout"
+	case errors.Is(err, ErrParse):
+		return "parse"
+	case errors.Is(err, ErrInvalidUTF8):
+		return "encoding"
+	case errors.Is(err, ErrEmptyResponse):
+		return "empty"
+	}
+	return "other"
+}
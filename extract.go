@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"io"
+	"strings"
+)
+
+// Extractores de preview por extensión (-extractors): producen un preview
+// más denso que los primeros bytes. Si no pueden con el contenido
+// devuelven ok=false y se usa el preview tal cual.
+var extractors = map[string]func(string) (string, bool){
+	".csv":  csvPreview,
+	".tsv":  csvPreview,
+	".json": jsonPreview,
+	".go":   goPreview,
+}
+
+// Filas de datos que se conservan tras la cabecera
+const csvPreviewRows = 10
+
+// Cabecera + primeras filas
+func csvPreview(s string) (string, bool) {
+	r := csv.NewReader(strings.NewReader(s))
+	r.LazyQuotes = true
+	r.FieldsPerRecord = -1
+	if strings.Count(firstLine(s), "\t") > strings.Count(firstLine(s), ",") {
+		r.Comma = '\t'
+	}
+	var b strings.Builder
+	w := csv.NewWriter(&b)
+	w.Comma = r.Comma
+	n := 0
+	for ; n <= csvPreviewRows; n++ {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if n == 0 {
+				return "", false
+			}
+			break // probablemente la última fila cortada por -max
+		}
+		w.Write(rec)
+	}
+	w.Flush()
+	if n == 0 {
+		return "", false
+	}
+	return b.String(), true
+}
+
+func firstLine(s string) string {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
+
+// JSON compacto reindentado (la estructura queda visible); con el preview
+// truncado por -max no es JSON válido y se deja como está
+func jsonPreview(s string) (string, bool) {
+	var b bytes.Buffer
+	if err := json.Indent(&b, []byte(s), "", " "); err != nil {
+		return "", false
+	}
+	return b.String(), true
+}
+
+// JSON sin espacios de formato (-preview-json-compact). Si el preview viene
+// cortado por -max se quitan igualmente los espacios fuera de las cadenas y
+// se corta tras el último miembro completo de primer nivel, para que el
+// modelo vea claves enteras en lugar de un valor a medias.
+func compactJSON(s string) string {
+	var b bytes.Buffer
+	if json.Compact(&b, []byte(s)) == nil {
+		return b.String()
+	}
+	var out strings.Builder
+	depth, cut := 0, 0
+	inStr, esc := false, false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if inStr {
+			out.WriteByte(c)
+			switch {
+			case esc:
+				esc = false
+			case c == '\\':
+				esc = true
+			case c == '"':
+				inStr = false
+			}
+			continue
+		}
+		switch c {
+		case ' ', '\t', '\n', '\r':
+			continue
+		case '"':
+			inStr = true
+		case '{', '[':
+			depth++
+		case '}', ']':
+			depth--
+		case ',':
+			if depth == 1 {
+				cut = out.Len()
+			}
+		}
+		out.WriteByte(c)
+	}
+	if cut == 0 {
+		return out.String()
+	}
+	return out.String()[:cut] + "\n… (truncado)"
+}
+
+// package, imports y firmas de las declaraciones de primer nivel (sin
+// cuerpos). Con un archivo truncado se usa lo que se haya podido parsear.
+func goPreview(s string) (string, bool) {
+	fset := token.NewFileSet()
+	f, _ := parser.ParseFile(fset, "", s, parser.SkipObjectResolution)
+	if f == nil || f.Name == nil {
+		return "", false
+	}
+	var b strings.Builder
+	b.WriteString("package " + f.Name.Name + "\n")
+	for _, im := range f.Imports {
+		b.WriteString("import " + im.Path.Value + "\n")
+	}
+	for _, d := range f.Decls {
+		switch d := d.(type) {
+		case *ast.FuncDecl:
+			fn := *d
+			fn.Body, fn.Doc = nil, nil
+			b.WriteString("\n")
+			printer.Fprint(&b, fset, &fn)
+		case *ast.GenDecl:
+			if d.Tok == token.IMPORT {
+				continue
+			}
+			for _, sp := range d.Specs {
+				b.WriteString("\n" + d.Tok.String() + " ")
+				switch sp := sp.(type) {
+				case *ast.TypeSpec:
+					ts := *sp
+					ts.Doc, ts.Comment = nil, nil
+					printer.Fprint(&b, fset, &ts)
+				case *ast.ValueSpec:
+					names := make([]string, len(sp.Names))
+					for i, n := range sp.Names {
+						names[i] = n.Name
+					}
+					b.WriteString(strings.Join(names, ", "))
+				}
+			}
+		}
+	}
+	return b.String() + "\n", true
+}
+
+// Declaración de primer nivel y sus líneas (1 = primera del archivo)
+type Symbol struct {
+	Name    string `json:"name"`
+	Line    int    `json:"line"`
+	EndLine int    `json:"end_line"`
+}
+
+// Extractores de símbolos por extensión (-symbols)
+var symbolExtractors = map[string]func(string) []Symbol{
+	".go": goSymbols,
+}
+
+// Funciones, métodos (Tipo.Método), tipos, constantes y variables. Como
+// goPreview, con un archivo truncado devuelve lo que se haya podido parsear.
+func goSymbols(s string) []Symbol {
+	fset := token.NewFileSet()
+	f, _ := parser.ParseFile(fset, "", s, parser.SkipObjectResolution)
+	if f == nil {
+		return nil
+	}
+	var syms []Symbol
+	add := func(name string, n ast.Node) {
+		syms = append(syms, Symbol{Name: name, Line: fset.Position(n.Pos()).Line, EndLine: fset.Position(n.End()).Line})
+	}
+	for _, d := range f.Decls {
+		switch d := d.(type) {
+		case *ast.FuncDecl:
+			name := d.Name.Name
+			if d.Recv != nil && len(d.Recv.List) > 0 {
+				name = recvName(d.Recv.List[0].Type) + "." + name
+			}
+			add(name, d)
+		case *ast.GenDecl:
+			for _, sp := range d.Specs {
+				switch sp := sp.(type) {
+				case *ast.TypeSpec:
+					add(sp.Name.Name, sp)
+				case *ast.ValueSpec:
+					for _, n := range sp.Names {
+						if n.Name != "_" {
+							add(n.Name, sp)
+						}
+					}
+				}
+			}
+		}
+	}
+	return syms
+}
+
+// Nombre del tipo receptor sin puntero ni parámetros de tipo
+func recvName(e ast.Expr) string {
+	switch t := e.(type) {
+	case *ast.StarExpr:
+		return recvName(t.X)
+	case *ast.IndexExpr:
+		return recvName(t.X)
+	case *ast.IndexListExpr:
+		return recvName(t.X)
+	case *ast.Ident:
+		return t.Name
+	}
+	return "?"
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Último commit que tocó un archivo (-git-meta)
+type GitMeta struct {
+	Commit string    `json:"commit"`
+	Author string    `json:"author"`
+	Date   time.Time `json:"date"`
+}
+
+// Indica si dir está dentro de un work tree de git (y git está instalado)
+func isGitRepo(dir string) bool {
+	out, err := exec.Command("git", "-C", dir, "rev-parse", "--is-inside-work-tree").Output()
+	return err == nil && strings.TrimSpace(string(out)) == "true"
+}
+
+// git log -1 sobre el archivo; nil si no está versionado o git falla
+func gitLastCommit(dir, path string) *GitMeta {
+	out, err := exec.Command("git", "-C", dir, "log", "-1", "--format=%H%x00%an%x00%aI", "--", path).Output()
+	if err != nil {
+		return nil
+	}
+	parts := strings.Split(strings.TrimSpace(string(out)), "\x00")
+	if len(parts) != 3 {
+		return nil
+	}
+	date, _ := time.Parse(time.RFC3339, parts[2])
+	return &GitMeta{Commit: parts[0], Author: parts[1], Date: date}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"path"
+	"strings"
+)
+
+// Patrones tipo "docs/**/*.md" relativos a -dir: cada segmento se compara
+// con path.Match y "**" cubre cero o más directorios
+func matchGlob(pattern, rel string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(rel, "/"))
+}
+
+func matchSegments(pat, segs []string) bool {
+	for len(pat) > 0 {
+		if pat[0] == "**" {
+			for i := 0; i <= len(segs); i++ {
+				if matchSegments(pat[1:], segs[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segs) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pat[0], segs[0]); !ok {
+			return false
+		}
+		pat, segs = pat[1:], segs[1:]
+	}
+	return len(segs) == 0
+}
+
+// Valida la sintaxis de los patrones antes de recorrer nada
+func checkGlobs(patterns []string) error {
+	for _, p := range patterns {
+		for _, seg := range strings.Split(p, "/") {
+			if _, err := path.Match(seg, ""); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// a va antes que b en el orden de filepath.WalkDir: segmento a segmento en
+// orden léxico, y un directorio antes que su contenido
+func walkBefore(a, b string) bool {
+	as, bs := strings.Split(a, "/"), strings.Split(b, "/")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		if as[i] != bs[i] {
+			return as[i] < bs[i]
+		}
+	}
+	return len(as) < len(bs)
+}
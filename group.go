@@ -0,0 +1,75 @@
+package main
+
+import (
+	"path"
+	"sort"
+	"strings"
+)
+
+// Grupo de ítems para -group-by: un directorio (con sus subdirectorios
+// anidados) o una extensión. Los ítems conservan su ruta completa.
+type Group struct {
+	Name   string      `json:"name"`
+	Items  []IndexItem `json:"items,omitempty"`
+	Groups []*Group    `json:"groups,omitempty"`
+}
+
+// Reparte los ítems del índice en grupos según by ("dir" o "ext"). Con
+// "dir" los archivos de la raíz se quedan en Items.
+func groupIndex(idx Index, by string) Index {
+	items := idx.Items
+	idx.Items = nil
+	switch by {
+	case "dir":
+		root := &Group{}
+		for _, it := range items {
+			g := root
+			for _, name := range itemDirs(it.Path) {
+				g = g.child(name)
+			}
+			g.Items = append(g.Items, it)
+		}
+		root.sort()
+		idx.Items, idx.Groups = root.Items, root.Groups
+	case "ext":
+		byExt := map[string]*Group{}
+		for _, it := range items {
+			ext := strings.ToLower(path.Ext(it.Path))
+			if byExt[ext] == nil {
+				byExt[ext] = &Group{Name: ext}
+				idx.Groups = append(idx.Groups, byExt[ext])
+			}
+			byExt[ext].Items = append(byExt[ext].Items, it)
+		}
+		sort.Slice(idx.Groups, func(i, j int) bool { return idx.Groups[i].Name < idx.Groups[j].Name })
+	}
+	return idx
+}
+
+// Directorios de una ruta del índice; las entradas de comprimidos van
+// con el directorio del comprimido
+func itemDirs(p string) []string {
+	if i := strings.Index(p, "!"); i >= 0 {
+		p = p[:i]
+	}
+	dirs := strings.Split(p, "/")
+	return dirs[:len(dirs)-1]
+}
+
+func (g *Group) child(name string) *Group {
+	for _, c := range g.Groups {
+		if c.Name == name {
+			return c
+		}
+	}
+	c := &Group{Name: name}
+	g.Groups = append(g.Groups, c)
+	return c
+}
+
+func (g *Group) sort() {
+	sort.Slice(g.Groups, func(i, j int) bool { return g.Groups[i].Name < g.Groups[j].Name })
+	for _, c := range g.Groups {
+		c.sort()
+	}
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"path"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+)
+
+// Ajustes de una ejecución para la etapa preview → resumen. Lo comparten
+// los archivos del recorrido y las entradas de archivos comprimidos.
+type indexer struct {
+	s      Summarizer
+	model  string
+	models []string         // -compare-models
+	routes map[string]route // -route, por extensión
+
+	skipRe      *regexp.Regexp // -skip-content-regex
+	onlyRe      *regexp.Regexp // -content-regex
+	stripHTML   bool
+	dedupLines  bool // -dedup-lines
+	collapseWS  bool // -collapse-whitespace
+	extractors  bool // -extractors: preview según el tipo de archivo
+	jsonCompact bool // -preview-json-compact
+	// -check-keywords: alguna keyword debe aparecer en el preview
+	checkKeywords bool
+	langHint      bool // -lang-hint: idioma detectado en el prompt
+	// -md-title: título de los Markdown; mdTitleContext lo antepone al preview
+	mdTitle, mdTitleContext bool
+	symbols                 bool            // -symbols
+	lineNumbers             map[string]bool // -line-numbers: extensiones con líneas numeradas
+	auditPrompts            bool            // -audit-prompts: prompt_hash de lo enviado
+	// Delimitadores de frontmatter a quitar (-strip-frontmatter)
+	frontmatter []string
+
+	summaryMaxChars int  // 0 = sin tope
+	latin1Fallback  bool // transcodificar previews no UTF-8 como ISO-8859-1
+
+	keywordsMin, keywordsMax int  // 0 = sin límite
+	keywordsBackfill         bool // completar hasta keywordsMin sin LLM
+	pathKeywords             bool // -min-keywords-fallback: keywords de la ruta si no hay otras
+
+	timeout        time.Duration
+	timeoutPerByte time.Duration
+	timeoutMax     time.Duration
+
+	breaker *circuitBreaker // -breaker-failures (nil = sin breaker)
+
+	// -embed-model: embedding de cada preview, en paralelo con el resumen
+	embedder   Embedder
+	embedModel string
+
+	// Primer 401/403: con credenciales inválidas no tiene sentido seguir
+	authErr atomic.Pointer[error]
+}
+
+// Summarizer y modelo asignados a una extensión con -route
+type route struct {
+	s     Summarizer
+	model string
+}
+
+// Filtra, transforma y resume un preview ya leído completando item. sc
+// son los valores manuales del sidecar (o nil). Devuelve false si el ítem
+// debe quedar fuera del índice.
+func (ix *indexer) process(item *IndexItem, preview string, sc *sidecar) bool {
+	// Solo se recorta una runa cortada por -max si el preview no es el
+	// archivo entero y el resto es UTF-8: en Latin-1 ese último byte (p. ej.
+	// la é de "café") es un carácter completo
+	if t := trimPartialRune(preview); int64(len(preview)) < item.Size && utf8.ValidString(t) {
+		preview = t
+	}
+	if !utf8.ValidString(preview) {
+		if !ix.latin1Fallback {
+			// Casi seguro binario: no se manda basura al LLM
+			item.Error = ErrInvalidUTF8.Error()
+			item.ErrorKind = errorKind(ErrInvalidUTF8)
+			return true
+		}
+		preview = latin1ToUTF8(preview)
+		item.Encoding = "iso-8859-1"
+	}
+
+	// Índices enfocados: fuera del índice lo que no coincide
+	if ix.onlyRe != nil && !ix.onlyRe.MatchString(preview) {
+		return false
+	}
+	// Archivos generados u otros que nunca queremos resumir
+	if ix.skipRe != nil && ix.skipRe.MatchString(preview) {
+		item.Note = "omitido: el contenido coincide con -skip-content-regex"
+		return true
+	}
+
+	preview, item.Sanitized = sanitizeControl(preview)
+
+	var metaKeywords []string
+	if len(ix.frontmatter) > 0 {
+		if meta, body, ok := splitFrontmatter(preview, ix.frontmatter); ok {
+			preview = body
+			metaKeywords = frontmatterKeywords(meta)
+		}
+	}
+	if ext := strings.ToLower(path.Ext(item.Path)); ix.mdTitle && (ext == ".md" || ext == ".markdown") {
+		item.Title = markdownTitle(preview)
+		if item.Title == "" {
+			item.Title = strings.TrimSuffix(path.Base(item.Path), path.Ext(item.Path))
+		}
+		if ix.mdTitleContext {
+			preview = "Título: " + item.Title + "\n\n" + preview
+		}
+	}
+	if ix.symbols {
+		if sym, ok := symbolExtractors[strings.ToLower(path.Ext(item.Path))]; ok {
+			item.Symbols = sym(preview)
+		}
+	}
+	// Con -line-numbers no se toca nada que cambie las líneas del archivo
+	numbered := ix.lineNumbers[strings.ToLower(path.Ext(item.Path))] && !isExcerpt(ix.s)
+	if ix.jsonCompact && strings.ToLower(path.Ext(item.Path)) == ".json" && !numbered {
+		preview = compactJSON(preview) // en lugar del extractor, que reindenta
+	} else if ix.extractors && !numbered {
+		if ex, ok := extractors[strings.ToLower(path.Ext(item.Path))]; ok {
+			if p, ok := ex(preview); ok {
+				preview = p
+			}
+		}
+	}
+	if ix.stripHTML && !numbered {
+		preview = stripHTML(preview)
+	}
+	if ix.collapseWS && !ix.stripHTML && !numbered {
+		preview = collapseSpaces(preview) // stripHTML ya lo hace
+	}
+	if ix.dedupLines && !numbered {
+		preview = dedupLines(preview)
+	}
+
+	// El embedding sale del mismo preview, en paralelo con el resumen
+	var vec []float32
+	var embedErr error
+	embedDone := make(chan struct{})
+	if ix.embedder != nil {
+		go func() {
+			defer close(embedDone)
+			vec, embedErr = ix.embed(item.Path, preview)
+		}()
+	} else {
+		close(embedDone)
+	}
+
+	var sum string
+	var kws []string
+	if sc != nil && sc.Summary != "" {
+		// El sidecar fija el resumen: sin llamada al LLM
+		sum = sc.Summary
+	} else {
+		// Los números solo los ve el modelo: las comprobaciones de keywords
+		// y el embedding usan el texto limpio
+		sent := preview
+		if numbered {
+			sent = numberLines(preview)
+		}
+		var err error
+		sum, kws, err = ix.summarize(item, sent)
+		if errors.Is(err, ErrAuth) {
+			ix.authErr.CompareAndSwap(nil, &err)
+		}
+		switch {
+		case errors.Is(err, ErrBudgetExhausted):
+			item.Note = "sin resumen: " + err.Error() + " (-max-tokens-total)"
+		case errors.Is(err, ErrCircuitOpen):
+			item.Note = "sin resumen: " + err.Error()
+		case err != nil:
+			item.Error = err.Error()
+			item.ErrorKind = errorKind(err)
+		}
+		sum = capSummary(sum, ix.summaryMaxChars)
+		if ix.checkKeywords && err == nil && len(kws) > 0 && !keywordsInText(kws, preview) {
+			item.LowConfidence = true
+			if item.Note == "" {
+				item.Note = "baja confianza: ninguna keyword aparece en el texto"
+			}
+		}
+	}
+
+	<-embedDone
+	item.Embedding = vec
+	switch {
+	case embedErr == nil || item.Error != "":
+	case errors.Is(embedErr, ErrBudgetExhausted), errors.Is(embedErr, ErrCircuitOpen):
+		if item.Note == "" {
+			item.Note = "sin embedding: " + embedErr.Error()
+		}
+	default:
+		item.Error = "embedding: " + embedErr.Error()
+		item.ErrorKind = errorKind(embedErr)
+	}
+
+	if sc != nil && len(sc.Keywords) > 0 {
+		kws = sc.Keywords
+	}
+	kws = mergeKeywords(kws, metaKeywords)
+	if sc != nil {
+		kws = mergeKeywords(kws, sc.ExtraKeywords)
+	}
+	if ix.keywordsMin > 0 || ix.keywordsMax > 0 {
+		kws = fitKeywords(kws, preview, ix.keywordsMin, ix.keywordsMax, ix.keywordsBackfill)
+	}
+	if len(kws) == 0 && ix.pathKeywords {
+		// Sin keywords del modelo, al menos las de la ruta (sin extensión)
+		kws = pathTokens(strings.TrimSuffix(item.Path, path.Ext(item.Path)))
+	}
+	if promptOpts.NoKeywords {
+		kws = nil
+	}
+	if promptOpts.KeywordsOnly {
+		sum = ""
+	}
+	item.Summary = sum
+	item.Keywords = kws
+	return true
+}
+
+// Llamada al LLM (con timeout por archivo) usando la ruta de -route o el
+// summarizer por defecto; con -compare-models, uno por modelo
+func (ix *indexer) summarize(item *IndexItem, preview string) (string, []string, error) {
+	if err := ix.aborted(); err != nil {
+		return "", nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), fileTimeout(ix.timeout, ix.timeoutPerByte, ix.timeoutMax, len(preview)))
+	defer cancel()
+	if ix.langHint {
+		item.Lang = detectLang(preview)
+		ctx = withLangHint(ctx, item.Lang)
+	}
+	s, model := ix.s, ix.model
+	if r, ok := ix.routes[strings.ToLower(path.Ext(item.Path))]; ok {
+		s, model = r.s, r.model
+		item.Model = model
+	}
+	if ix.breaker != nil {
+		if err := ix.breaker.allow(); err != nil {
+			return "", nil, err
+		}
+	}
+	if ix.auditPrompts {
+		ctx = withPromptHash(ctx, &item.PromptHash)
+	}
+	start := time.Now()
+	defer func() { item.DurationMs = time.Since(start).Milliseconds() }()
+	if len(ix.models) == 0 {
+		sum, kws, err := s.Summarize(ctx, model, item.Path, preview)
+		if ix.breaker != nil {
+			ix.breaker.record(err)
+		}
+		if err == nil && isExcerpt(s) {
+			item.SummaryKind = "excerpt"
+		}
+		return sum, kws, err
+	}
+	item.Alternatives = compareModels(ctx, s, ix.models, item.Path, preview)
+	var sum string
+	var kws []string
+	var err error
+	for _, a := range item.Alternatives {
+		if !a.Chosen {
+			continue
+		}
+		sum, kws, err = a.Summary, a.Keywords, a.err
+	}
+	// El breaker ve el resultado de la alternativa elegida
+	if ix.breaker != nil {
+		ix.breaker.record(err)
+	}
+	return sum, kws, err
+}
+
+// Embedding de text con las mismas barreras que el resumen: credenciales
+// inválidas y circuit breaker (el presupuesto lo lleva budgetEmbedder)
+func (ix *indexer) embed(path, text string) ([]float32, error) {
+	if err := ix.aborted(); err != nil {
+		return nil, err
+	}
+	if ix.breaker != nil {
+		if err := ix.breaker.allow(); err != nil {
+			return nil, err
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), ix.timeout)
+	defer cancel()
+	vec, err := ix.embedder.Embed(withAuditPath(ctx, path), ix.embedModel, text)
+	if ix.breaker != nil {
+		ix.breaker.record(err)
+	}
+	if errors.Is(err, ErrAuth) {
+		ix.authErr.CompareAndSwap(nil, &err)
+	}
+	return vec, err
+}
+
+// Error de credenciales que aborta la ejecución (nil si no lo hubo)
+func (ix *indexer) aborted() error {
+	if p := ix.authErr.Load(); p != nil {
+		return *p
+	}
+	return nil
+}
+
+// Recorta un resumen a max caracteres: preferentemente al final de una
+// frase, si no en un límite de palabra, y añade "…"
+func capSummary(s string, max int) string {
+	r := []rune(s)
+	if max <= 0 || len(r) <= max {
+		return s
+	}
+	cut := string(r[:max-1])
+	if i := strings.LastIndexAny(cut, ".!?"); i >= len(cut)/2 {
+		return cut[:i+1] + "…"
+	}
+	if i := strings.LastIndexAny(cut, " \t\n"); i > 0 {
+		cut = cut[:i]
+	}
+	return strings.TrimRight(cut, " ,;:") + "…"
+}
+
+// Timeout por archivo: base + bytes*porByte, acotado a max (si hay escalado)
+func fileTimeout(base, perByte, max time.Duration, n int) time.Duration {
+	if perByte <= 0 {
+		return base
+	}
+	t := base + time.Duration(n)*perByte
+	if max > 0 && t > max {
+		t = max
+	}
+	return t
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Palabras vacías (es/en) que nunca sirven de keyword de relleno
+var stopwords = map[string]bool{}
+
+func init() {
+	for _, w := range splitList("para,pero,como,este,esta,estos,estas,porque,desde,hasta,sobre,entre,cuando,donde,también,tiene,tienen,puede,pueden,todo,todos,cada,otro,otra,otros,sus,son,del,los,las,una,uno,unos,unas,with,from,that,this,these,those,there,their,have,will,would,should,could,into,than,then,them,they,what,when,where,which,while,about,after,before,your,been,were,also,only,such,each,more,most,some,other,over,under") {
+		stopwords[w] = true
+	}
+}
+
+// Normaliza las keywords (minúsculas, sin duplicados) y las ajusta a
+// [min, max]: recorta el exceso y, con backfill, completa hasta min con los
+// términos más frecuentes del preview. min/max 0 = sin límite.
+func fitKeywords(kws []string, preview string, min, max int, backfill bool) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, k := range kws {
+		k = strings.ToLower(strings.TrimSpace(k))
+		if k != "" && !seen[k] {
+			seen[k] = true
+			out = append(out, k)
+		}
+	}
+	if backfill && len(out) < min {
+		out = append(out, frequentTerms(preview, min-len(out), seen)...)
+	}
+	if max > 0 && len(out) > max {
+		out = out[:max]
+	}
+	return out
+}
+
+// Los n términos más repetidos del texto (≥4 letras, sin palabras vacías
+// ni los de exclude); a igual frecuencia, el que aparece antes
+func frequentTerms(text string, n int, exclude map[string]bool) []string {
+	count := map[string]int{}
+	var order []string
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, w := range words {
+		if utf8.RuneCountInString(w) < 4 || stopwords[w] || exclude[w] || strings.IndexFunc(w, unicode.IsLetter) < 0 {
+			continue
+		}
+		if count[w] == 0 {
+			order = append(order, w)
+		}
+		count[w]++
+	}
+	sort.SliceStable(order, func(i, j int) bool { return count[order[i]] > count[order[j]] })
+	if len(order) > n {
+		order = order[:n]
+	}
+	return order
+}
+
+// Alguna keyword (o alguna de sus palabras) aparece en el texto, sin
+// distinguir mayúsculas. Si ninguna, el resumen probablemente no es de
+// este archivo.
+func keywordsInText(kws []string, text string) bool {
+	text = strings.ToLower(text)
+	for _, k := range kws {
+		k = strings.ToLower(strings.TrimSpace(k))
+		if k != "" && strings.Contains(text, k) {
+			return true
+		}
+		for _, w := range strings.Fields(k) {
+			if utf8.RuneCountInString(w) >= 4 && strings.Contains(text, w) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Lee -keyword-synonyms: JSON {"canónico": ["variante", ...]} y devuelve
+// el mapa variante → canónico (en minúsculas)
+func loadSynonyms(path string) (map[string]string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var groups map[string][]string
+	if err := json.Unmarshal(b, &groups); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	syn := map[string]string{}
+	for canon, variants := range groups {
+		canon = strings.ToLower(strings.TrimSpace(canon))
+		for _, v := range variants {
+			v = strings.ToLower(strings.TrimSpace(v))
+			if prev, ok := syn[v]; ok && prev != canon {
+				return nil, fmt.Errorf("%s: %q aparece como variante de %q y de %q", path, v, prev, canon)
+			}
+			syn[v] = canon
+		}
+	}
+	return syn, nil
+}
+
+// Sustituye cada variante por su término canónico, sin duplicados
+func canonicalKeywords(kws []string, syn map[string]string) []string {
+	seen := map[string]bool{}
+	out := kws[:0:0]
+	for _, k := range kws {
+		if c, ok := syn[strings.ToLower(strings.TrimSpace(k))]; ok {
+			k = c
+		}
+		if !seen[strings.ToLower(k)] {
+			seen[strings.ToLower(k)] = true
+			out = append(out, k)
+		}
+	}
+	return out
+}
+
+// Keywords derivadas solo de la ruta (-names-only): directorios y nombre
+// partidos por separadores y camelCase, en minúsculas y sin repetir
+func pathTokens(p string) []string {
+	var out []string
+	seen := map[string]bool{}
+	add := func(w string) {
+		w = strings.ToLower(w)
+		if utf8.RuneCountInString(w) < 2 || stopwords[w] || seen[w] || strings.IndexFunc(w, unicode.IsLetter) < 0 {
+			return
+		}
+		seen[w] = true
+		out = append(out, w)
+	}
+	parts := strings.FieldsFunc(p, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+	for _, part := range parts {
+		// "readmeFile" → "readme", "file"; "HTTPServer" → "http", "server"
+		rs := []rune(part)
+		start := 0
+		for i := 1; i < len(rs); i++ {
+			lowerToUpper := unicode.IsLower(rs[i-1]) && unicode.IsUpper(rs[i])
+			acronymEnd := i+1 < len(rs) && unicode.IsUpper(rs[i-1]) && unicode.IsUpper(rs[i]) && unicode.IsLower(rs[i+1])
+			if lowerToUpper || acronymEnd {
+				add(string(rs[start:i]))
+				start = i
+			}
+		}
+		add(string(rs[start:]))
+	}
+	return out
+}
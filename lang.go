@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"unicode"
+)
+
+// Palabras muy frecuentes por idioma; el que más aparece en el preview gana
+var langWords = map[string][]string{
+	"es": {"el", "la", "los", "las", "de", "que", "y", "en", "un", "una", "por", "con", "para", "es", "se", "del", "al", "como", "pero", "más"},
+	"en": {"the", "and", "of", "to", "in", "is", "that", "it", "for", "with", "as", "on", "was", "this", "are", "be", "by", "not", "or", "from"},
+	"pt": {"o", "os", "as", "do", "da", "dos", "das", "que", "em", "um", "uma", "para", "com", "não", "se", "na", "no", "por", "mais", "é"},
+	"fr": {"le", "les", "des", "et", "est", "dans", "une", "du", "pour", "que", "qui", "pas", "sur", "au", "avec", "ce", "il", "sont", "plus", "ou"},
+	"de": {"der", "die", "das", "und", "ist", "nicht", "mit", "den", "von", "zu", "ein", "eine", "auf", "für", "sich", "dem", "des", "auch", "es", "im"},
+	"it": {"il", "di", "che", "è", "per", "non", "una", "sono", "gli", "della", "con", "del", "nel", "anche", "come", "più", "ma", "le", "dei", "alla"},
+}
+
+var langNames = map[string]string{
+	"es": "español", "en": "inglés", "pt": "portugués", "fr": "francés", "de": "alemán", "it": "italiano",
+}
+
+// Detección barata del idioma (código ISO 639-1) por palabras frecuentes.
+// "" si el texto es demasiado corto o no hay un idioma claro.
+func detectLang(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool { return !unicode.IsLetter(r) })
+	if len(words) < 20 {
+		return ""
+	}
+	count := map[string]int{}
+	for lang, ws := range langWords {
+		set := map[string]bool{}
+		for _, w := range ws {
+			set[w] = true
+		}
+		for _, w := range words {
+			if set[w] {
+				count[lang]++
+			}
+		}
+	}
+	best, second := "", 0
+	for _, lang := range []string{"es", "en", "pt", "fr", "de", "it"} {
+		switch n := count[lang]; {
+		case best == "" || n > count[best]:
+			second = count[best]
+			best = lang
+		case n > second:
+			second = n
+		}
+	}
+	// Exigir un mínimo y cierta ventaja (es/pt/it comparten muchas)
+	if count[best] < 5 || count[best] < second*5/4 {
+		return ""
+	}
+	return best
+}
+
+type langKey struct{}
+
+// El idioma detectado viaja en el contexto hasta prompt (-lang-hint)
+func withLangHint(ctx context.Context, lang string) context.Context {
+	if lang == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, langKey{}, lang)
+}
+
+// Línea del prompt con el idioma del texto, o "" si no se conoce
+func langInstruction(ctx context.Context) string {
+	lang, _ := ctx.Value(langKey{}).(string)
+	if name, ok := langNames[lang]; ok {
+		return "Idioma del texto: " + name + ". Escribe summary y keywords en " + name + ".\n"
+	}
+	return ""
+}
@@ -1,16 +1,24 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"crypto/sha256"
 	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"io/fs"
 	"net/http"
 	"os"
 	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -22,6 +30,16 @@ type Index struct {
 	Generated time.Time   `json:"generated"`
 	Model     string      `json:"model"`
 	Items     []IndexItem `json:"items"`
+	// Con -per-dir: índices de cada subdirectorio, relativos a Dir
+	Subindexes []string `json:"subindexes,omitempty"`
+	// Con -group-by: ítems anidados por directorio o extensión
+	Groups []*Group `json:"groups,omitempty"`
+	// Modelo de los embeddings de los ítems (-embed-model)
+	EmbeddingModel string `json:"embedding_model,omitempty"`
+	// Etiquetas libres de -tag (entorno, dataset, id de ejecución...)
+	Tags map[string]string `json:"tags,omitempty"`
+	// Versión de text-indexer que generó el índice
+	GeneratorVersion string `json:"generator_version,omitempty"`
 }
 
 // Estructura para un ítem del índice
@@ -32,6 +50,64 @@ type IndexItem struct {
 	Summary  string    `json:"summary"`
 	Keywords []string  `json:"keywords"`
 	Error    string    `json:"error,omitempty"`
+	Note     string    `json:"note,omitempty"`
+	// Categoría del error: auth, rate_limit, timeout, parse, encoding u other
+	ErrorKind string `json:"error_kind,omitempty"`
+	// Duración de la llamada a Summarize en milisegundos
+	DurationMs int64 `json:"duration_ms,omitempty"`
+	// Codificación asumida cuando el preview no era UTF-8 (-latin1-fallback)
+	Encoding string `json:"encoding,omitempty"`
+	// El preview tenía caracteres de control o finales de línea mixtos
+	Sanitized bool `json:"sanitized,omitempty"`
+	// Último commit del archivo con -git-meta
+	Git *GitMeta `json:"git,omitempty"`
+	// Modelo usado cuando -route asigna uno distinto al del índice
+	Model string `json:"model,omitempty"`
+	// Resultados por modelo con -compare-models
+	Alternatives []Alternative `json:"alternatives,omitempty"`
+	// Vector del preview con -embed-model (modelo en Index.EmbeddingModel)
+	Embedding []float32 `json:"embedding,omitempty"`
+	// "excerpt" si summary es un extracto del archivo, no un resumen del LLM
+	SummaryKind string `json:"summary_kind,omitempty"`
+	// Título de un Markdown (primer "# ...", o el nombre) con -md-title
+	Title string `json:"title,omitempty"`
+	// Idioma detectado del contenido con -lang-hint (es, en, pt...)
+	Lang string `json:"lang,omitempty"`
+	// Ninguna keyword del modelo aparece en el preview (-check-keywords)
+	LowConfidence bool `json:"low_confidence,omitempty"`
+	// Grupo de ítems con resúmenes casi iguales (-summary-dedup)
+	Cluster string `json:"cluster,omitempty"`
+	// Id estable con -doc-id, para seguir el documento aunque cambie Path
+	DocID string `json:"doc_id,omitempty"`
+	// Hash de la última petición enviada, para cruzarlo con el log de -audit-prompts
+	PromptHash string `json:"prompt_hash,omitempty"`
+	// Declaraciones de primer nivel con sus líneas (-symbols, solo .go)
+	Symbols []Symbol `json:"symbols,omitempty"`
+}
+
+// Opciones globales que dan forma al prompt; se fijan una vez desde los flags
+type promptOptions struct {
+	NoKeywords   bool   // pedir solo summary
+	KeywordsOnly bool   // pedir solo keywords
+	StrictJSON   bool   // la respuesta completa debe ser JSON válido (sin rescate)
+	Reprompt     bool   // un reintento corrigiendo al modelo si no devolvió JSON
+	SummaryStyle string // oneline, abstract (por defecto) o bullets
+}
+
+var promptOpts promptOptions
+
+// Seed fija para -deterministic
+const deterministicSeed = 42
+
+// Centinela para cortar el recorrido antes de tiempo (p. ej. -max-files)
+var errStopWalk = errors.New("recorrido detenido")
+
+// Pasa a UTC las fechas del ítem (-utc)
+func (it *IndexItem) toUTC() {
+	it.ModTime = it.ModTime.UTC()
+	if it.Git != nil {
+		it.Git.Date = it.Git.Date.UTC()
+	}
 }
 
 type Summarizer interface {
@@ -39,97 +115,1034 @@ type Summarizer interface {
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "schema" {
+		if err := runSchema(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// "doctor": mismos flags y entorno que una ejecución normal
+	doctor := len(os.Args) > 1 && os.Args[1] == "doctor"
+	if doctor {
+		os.Args = append(os.Args[:1], os.Args[2:]...)
+	}
+
 	dir := flag.String("dir", "", "Directorio a indexar")
 	out := flag.String("out", "index.json", "Archivo JSON de salida")
 	maxBytes := flag.Int("max", 64*1024, "Máximo de bytes a leer por archivo")
 	include := flag.String("include", ".txt,.md,.log,.rst,.json,.yaml,.yml,.toml,.go,.py,.js,.ts", "Extensiones de texto (coma separadas)")
 	timeout := flag.Duration("timeout", 30*time.Second, "Timeout por archivo para llamada al LLM")
+	timeoutPerByte := flag.Duration("timeout-per-byte", 0, "Tiempo extra por byte de preview sumado a -timeout (p. ej. 100µs)")
+	timeoutMax := flag.Duration("timeout-max", 5*time.Minute, "Tope del timeout adaptativo de -timeout-per-byte")
+	skipContent := flag.String("skip-content-regex", "", "Omitir (sin LLM) archivos cuyo contenido coincida con esta regex")
+	onlyContent := flag.String("content-regex", "", "Indexar solo archivos cuyo contenido coincida con esta regex")
+	flag.BoolVar(&promptOpts.NoKeywords, "no-keywords", false, "Pedir solo el resumen (keywords vacías)")
+	flag.BoolVar(&promptOpts.KeywordsOnly, "keywords-only", false, "Pedir solo keywords (summary vacío)")
+	flag.BoolVar(&promptOpts.Reprompt, "reprompt", false, "Si la respuesta no es JSON, reenviarla una vez pidiendo corregirla")
+	flag.BoolVar(&promptOpts.StrictJSON, "strict-json", false, "Error si la respuesta no es JSON limpio (sin buscar llaves)")
+	maxFiles := flag.Int("max-files", 0, "Procesar como mucho N archivos (0 = sin límite)")
+	envFile := flag.String("env-file", ".env", "Archivo KEY=VALUE con credenciales (las variables reales tienen prioridad)")
+	openaiAPI := flag.String("openai-api", "chat", "Endpoint OpenAI: chat (Chat Completions) o responses")
+	perFileOut := flag.String("per-file-out", "", "Además, escribir un JSON por archivo en este directorio (<dir>/<ruta>.json)")
+	dedup := flag.Bool("dedup", true, "Una sola llamada al LLM por contenido idéntico dentro de la ejecución")
+	skipExisting := flag.Bool("skip-existing-summaries", false, "No tocar archivos que ya tienen summary en el -out previo")
+	loadTimeout := flag.Duration("load-timeout", 2*time.Minute, "Tiempo máximo para cargar un índice previo")
+	compare := flag.String("compare-models", "", "Resumir con varios modelos (coma separados) y guardar todas las alternativas")
+	stripHTMLFlag := flag.Bool("strip-html", false, "Quitar etiquetas HTML y compactar espacios del preview")
+	archives := flag.Bool("archives", false, "Indexar el contenido de .zip/.tar/.tar.gz (rutas como bundle.zip!docs/readme.md)")
+	deterministic := flag.Bool("deterministic", false, "Temperatura 0 y seed fija para resultados reproducibles")
+	perDir := flag.Bool("per-dir", false, "Escribir un índice en cada subdirectorio de primer nivel y un índice raíz que los referencia")
+	workers := flag.Int("jobs", 1, "Archivos procesados en paralelo (máximo con -adaptive)")
+	adaptive := flag.Bool("adaptive", false, "Ajustar la concurrencia sola (AIMD): sube con éxitos y baja a la mitad ante 429")
+	workersMin := flag.Int("jobs-min", 1, "Concurrencia mínima (y de arranque) con -adaptive")
+	gitMeta := flag.Bool("git-meta", false, "Añadir hash, autor y fecha del último commit de cada archivo (si -dir es un repo git)")
+	summaryMax := flag.Int("summary-max-chars", 600, "Recortar resúmenes más largos (en frase o palabra, con …); 0 = sin tope")
+	stripFM := flag.Bool("strip-frontmatter", false, "Quitar el bloque de metadatos inicial antes de resumir (sus tags/keywords se añaden a keywords)")
+	fmDelims := flag.String("frontmatter-delims", "---,+++", "Delimitadores de frontmatter (coma separados)")
+	streamOut := flag.Bool("stream", false, "Escribir los ítems en -out según terminan, sin retener el índice en memoria")
+	routeSpec := flag.String("route", "", "Proveedor/modelo por extensión: .go=ollama:codellama,.md=openai:gpt-4o")
+	slashPaths := flag.Bool("slash-paths", false, "Usar / también en Index.Dir (índices idénticos entre Windows y Linux)")
+	sidecars := flag.Bool("sidecars", true, "Leer <archivo>.index.yaml con summary/keywords fijados a mano")
+	maxTokens := flag.Int64("max-tokens-total", 0, "Dejar de llamar al LLM al superar estos tokens estimados en total (0 = sin tope)")
+	latin1 := flag.Bool("latin1-fallback", false, "Leer como ISO-8859-1 los previews que no son UTF-8 válido")
+	ollamaNumCtx := flag.Int("ollama-num-ctx", 0, "Ollama: tamaño de contexto (options.num_ctx) para previews grandes")
+	ollamaNumPredict := flag.Int("ollama-num-predict", 0, "Ollama: máximo de tokens generados (options.num_predict)")
+	ollamaKeepAlive := flag.String("ollama-keep-alive", "", "Ollama: mantener el modelo cargado entre archivos (p. ej. 10m)")
+	utc := flag.Bool("utc", false, "Escribir todas las fechas en UTC (índices comparables entre máquinas)")
+	execCmd := flag.String("exec-cmd", "", "Proveedor exec: comando que recibe el nombre como último argumento y el preview por stdin, y devuelve {summary, keywords}")
+	dedupLinesFlag := flag.Bool("dedup-lines", false, "Colapsar líneas consecutivas repetidas del preview en una con (xN)")
+	headBytes := flag.Int("head-bytes", 0, "Bytes del principio del archivo en el preview (0 = -max)")
+	tailBytes := flag.Int("tail-bytes", 0, "Bytes del final del archivo añadidos al preview tras \"...\" (0 = solo el principio)")
+	sample := flag.String("sample", "", "Preview de muestras repartidas por el archivo en lugar del principio: middle (una ventana central) o even (-sample-windows ventanas)")
+	sampleWindows := flag.Int("sample-windows", 5, "Ventanas de -sample even; entre todas suman -max bytes")
+	tailExt := flag.String("tail-ext", "", "Extensiones cuyo preview son los últimos -max bytes en lugar de los primeros (.log,.out)")
+	kwMin := flag.Int("keywords-min", 0, "Mínimo de keywords por archivo (con -keywords-backfill se completa con términos frecuentes)")
+	kwMax := flag.Int("keywords-max", 0, "Máximo de keywords por archivo; el exceso se recorta (0 = sin tope)")
+	kwBackfill := flag.Bool("keywords-backfill", false, "Completar hasta -keywords-min con los términos más frecuentes del preview")
+	retryErrors := flag.Bool("retry-errors", false, "Volver a resumir solo los ítems con error del -out previo y conservar el resto")
+	extractorsFlag := flag.Bool("extractors", false, "Preview según el tipo: cabecera y filas de CSV, JSON reindentado, firmas de Go")
+	flag.IntVar(&httpTransport.MaxConnsPerHost, "max-conns-per-host", 0, "Conexiones simultáneas por host del proveedor (0 = sin límite), aparte de -jobs")
+	flag.IntVar(&httpTransport.MaxIdleConnsPerHost, "max-idle-conns-per-host", http.DefaultMaxIdleConnsPerHost, "Conexiones ociosas que se reutilizan por host")
+	checkKeywords := flag.Bool("check-keywords", false, "Marcar low_confidence si ninguna keyword devuelta aparece en el preview")
+	flag.BoolVar(&prettyJSON, "pretty", true, "JSON indentado; -pretty=false lo escribe compacto (más pequeño, para consumo programático)")
+	flag.BoolVar(&canonicalJSON, "canonical", false, "Escribir todos los campos de cada ítem, también los vacíos, en orden alfabético (diffs limpios en git)")
+	flag.BoolVar(&keepTmpOnError, "keep-tmp-on-error", false, "Si el índice no se puede serializar, dejar el .tmp con los ítems que sí se pudieron (los demás con error) para inspeccionarlo")
+	flushInterval := flag.Duration("flush-interval", 0, "Reescribir -out con el índice parcial cada este intervalo durante la ejecución (0 = solo al final)")
+	synonymsFile := flag.String("keyword-synonyms", "", "JSON {\"canónico\": [\"variante\", ...]} para unificar keywords en todo el índice")
+	var previewCmdSpecs multiFlag
+	flag.Var(&previewCmdSpecs, "preview-cmd", "Conversor por extensión cuyo stdout es el preview: .docx=pandoc -t plain (repetible)")
+	showVersion := flag.Bool("version", false, "Mostrar versión, commit y fecha de compilación y salir")
+	langHint := flag.Bool("lang-hint", false, "Detectar el idioma del archivo (lang) y pedir summary y keywords en ese idioma")
+	maxInflight := flag.Int64("max-inflight-bytes", 0, "Tope de bytes de previews en memoria a la vez entre todos los workers (0 = sin tope)")
+	groupBy := flag.String("group-by", "", "Agrupar los ítems en la salida: dir (árbol de directorios) o ext (por extensión)")
+	collapseWS := flag.Bool("collapse-whitespace", false, "Compactar espacios del preview: sin sangría, espacios seguidos a uno y como mucho una línea en blanco")
+	flag.Int64Var(&maxResponseBytes, "max-response-bytes", maxResponseBytes, "Máximo de bytes leídos de una respuesta del proveedor; más es un error")
+	var tagSpecs multiFlag
+	flag.Var(&tagSpecs, "tag", "Etiqueta clave=valor que se guarda en tags del índice (repetible)")
+	var headerSpecs multiFlag
+	flag.Var(&headerSpecs, "header", "Cabecera 'Nombre: valor' añadida a cada petición al proveedor (repetible)")
+	namesOnly := flag.Bool("names-only", false, "Solo keywords a partir de la ruta y el nombre, sin leer el contenido ni llamar al LLM")
+	resumeFrom := flag.String("resume-from", "", "Retomar el recorrido en esta ruta relativa: lo anterior no se recorre y se conserva del -out previo")
+	flag.StringVar(&promptOpts.SummaryStyle, "summary-style", "abstract", "Forma del resumen: oneline (título), abstract (1-2 frases) o bullets (viñetas \"- \" separadas por saltos de línea)")
+	mdTitle := flag.Bool("md-title", false, "Guardar en title el primer encabezado # de los Markdown (o el nombre del archivo), sin LLM")
+	symbols := flag.Bool("symbols", false, "Guardar en symbols las declaraciones de primer nivel de los archivos de código (.go) con su línea")
+	mdTitleContext := flag.Bool("md-title-context", false, "Con -md-title, anteponer el título al preview que se resume")
+	breakerFailures := flag.Int("breaker-failures", 0, "Tras N fallos seguidos del proveedor, pausar -breaker-cooldown y probar antes de seguir (0 = desactivado)")
+	breakerCooldown := flag.Duration("breaker-cooldown", 30*time.Second, "Pausa del circuit breaker antes de la llamada de prueba")
+	publish := flag.String("publish-dir", "", "Además de -out, publicar índice y manifiesto (conteos, errores, duración, tokens, flags) juntos en este directorio")
+	embedModel := flag.String("embed-model", "", "Calcular también el embedding de cada archivo con este modelo (openai u ollama), en paralelo con el resumen")
+	skipRatio := flag.Int64("skip-ratio", 0, "Omitir archivos mayores que N veces el preview (-max): su resumen saldría de una fracción mínima (0 = no omitir)")
+	tokDir := flag.String("tokenizer-dir", os.Getenv("TIKTOKEN_DIR"), "Directorio con vocabularios <codificación>.tiktoken (cl100k_base, o200k_base) para contar tokens exactos con modelos de OpenAI")
+	keepGoing := flag.Bool("keep-going-on-write-error", false, "Con -per-dir/-per-file-out, seguir si falla la escritura de una salida y listar los fallos al final (sale con 1)")
+	jsonCompact := flag.Bool("preview-json-compact", false, "Mandar los .json sin espacios de formato; si el preview está cortado, hasta el último miembro completo de primer nivel")
+	sinceIndex := flag.String("since-index", "", "Índice previo: conservar sus ítems y resumir solo los archivos modificados después de su generated (o nuevos)")
+	retries := flag.Int("retries", 0, "Reintentos por archivo ante rate limit, timeout o 5xx, con backoff exponencial")
+	retryBase := flag.Duration("retry-base", time.Second, "Espera antes del primer reintento; se duplica en cada uno")
+	retryMax := flag.Duration("retry-max", 30*time.Second, "Tope de la espera entre reintentos")
+	retryBudget := flag.Int64("retry-budget", 0, "Tope de reintentos entre todos los archivos; agotado, los fallos ya no se reintentan (0 = sin tope)")
+	retryJitter := flag.Bool("summarize-retry-jitter", true, "Esperar un tiempo al azar entre 0 y el backoff, para que los workers no reintenten todos a la vez")
+	auditPrompts := flag.String("audit-prompts", "", "Añadir a este JSONL cada petición enviada al proveedor (fecha, ruta, modelo, destino, cuerpo completo, hash) y guardar prompt_hash en cada ítem")
+	cacheDir := flag.String("cache-dir", "", "Caché de resúmenes entre ejecuciones, por contenido (no por ruta): un archivo idéntico reutiliza el resumen")
+	lineNumbers := flag.Bool("line-numbers", false, "Numerar las líneas del preview de los archivos de código para que el resumen cite ubicaciones")
+	lineNumbersExt := flag.String("line-numbers-ext", ".go,.py,.js,.ts,.java,.c,.h,.cpp,.rs,.rb,.php,.sh", "Extensiones a las que se aplica -line-numbers")
+	mkdirOut := flag.Bool("mkdir", false, "Crear el directorio de -out si no existe")
+	order := flag.String("order", "", "Orden en que se reparten los archivos a los workers: largest, smallest, name o mtime (vacío = el del recorrido)")
+	docIDScheme := flag.String("doc-id", "", "Guardar un doc_id estable por archivo: content (hash del contenido, sobrevive a renombrados) o path (hash de la ruta)")
+	pathKeywords := flag.Bool("min-keywords-fallback", false, "Si un ítem se queda sin keywords, usar las de su ruta y nombre (sin extensión)")
+	summaryDedup := flag.Float64("summary-dedup", 0, "Marcar con el mismo cluster los ítems cuyos resúmenes se parecen al menos tanto (0-1, Jaccard; 0 = no comparar)")
+	apiKeyFile := flag.String("api-key-file", "", "Leer la API key de este archivo (secretos montados de Docker/Kubernetes) en lugar de LLM_API_KEY")
+	walkConc := flag.Int("walk-concurrency", 1, "Directorios que se leen a la vez durante el recorrido (más de 1 ayuda en NFS o sistemas sobre S3)")
+	statsOut := flag.String("stats-out", "", "Escribir en este JSON un resumen del corpus: archivos, bytes, por extensión, errores, longitud media del summary, idiomas")
+	emptyDirs := flag.Bool("include-empty-dirs", false, "Con -per-dir, escribir también índices vacíos para subdirectorios sin archivos indexables")
+	requireLLM := flag.Bool("require-llm", false, "Fallar si no hay proveedor LLM utilizable (en vez de índice sin resumen)")
 	flag.Parse()
+	if *showVersion {
+		printVersion()
+		return
+	}
+
+	started := time.Now()
+
+	// .env por defecto es opcional; uno pedido explícitamente debe existir
+	if err := loadEnvFile(*envFile); err != nil && (!errors.Is(err, os.ErrNotExist) || flagSet("env-file")) {
+		fmt.Fprintln(os.Stderr, "env-file:", err)
+		os.Exit(1)
+	}
+
+	if *openaiAPI != "chat" && *openaiAPI != "responses" {
+		fmt.Fprintln(os.Stderr, "-openai-api debe ser chat o responses")
+		os.Exit(1)
+	}
+	if *streamOut && (*perDir || *perFileOut != "" || *flushInterval > 0) {
+		fmt.Fprintln(os.Stderr, "-stream no se combina con -per-dir, -per-file-out ni -flush-interval")
+		os.Exit(1)
+	}
+	if *kwMax > 0 && *kwMin > *kwMax {
+		fmt.Fprintln(os.Stderr, "-keywords-min no puede ser mayor que -keywords-max")
+		os.Exit(1)
+	}
+	if *groupBy != "" && *groupBy != "dir" && *groupBy != "ext" {
+		fmt.Fprintln(os.Stderr, "-group-by debe ser dir o ext")
+		os.Exit(1)
+	}
+	if *publish != "" && (*streamOut || *perDir) {
+		fmt.Fprintln(os.Stderr, "-publish-dir no se combina con -stream ni -per-dir")
+		os.Exit(1)
+	}
+	if *statsOut != "" && *streamOut {
+		fmt.Fprintln(os.Stderr, "-stats-out no se combina con -stream")
+		os.Exit(1)
+	}
+	if canonicalJSON && *streamOut {
+		fmt.Fprintln(os.Stderr, "-canonical no se combina con -stream")
+		os.Exit(1)
+	}
+	if *summaryDedup > 0 && *streamOut {
+		fmt.Fprintln(os.Stderr, "-summary-dedup no se combina con -stream")
+		os.Exit(1)
+	}
+	// El -out de -per-dir solo tiene los ítems de la raíz: lo reutilizado
+	// de los subíndices se perdería
+	if *perDir && (*skipExisting || *retryErrors || *resumeFrom != "" || *sinceIndex != "") {
+		fmt.Fprintln(os.Stderr, "-per-dir no se combina con -skip-existing-summaries, -retry-errors, -resume-from ni -since-index")
+		os.Exit(1)
+	}
+	if *groupBy != "" && (*streamOut || *perDir) {
+		fmt.Fprintln(os.Stderr, "-group-by no se combina con -stream ni -per-dir")
+		os.Exit(1)
+	}
+	if *docIDScheme != "" && *docIDScheme != "content" && *docIDScheme != "path" {
+		fmt.Fprintln(os.Stderr, "-doc-id debe ser content o path")
+		os.Exit(1)
+	}
+	switch {
+	case *sample != "" && *sample != "middle" && *sample != "even":
+		fmt.Fprintln(os.Stderr, "-sample debe ser middle o even")
+		os.Exit(1)
+	case *sample != "" && (*headBytes > 0 || *tailBytes > 0):
+		fmt.Fprintln(os.Stderr, "-sample no se combina con -head-bytes ni -tail-bytes")
+		os.Exit(1)
+	}
+	switch *order {
+	case "", "largest", "smallest", "name", "mtime":
+	default:
+		fmt.Fprintln(os.Stderr, "-order debe ser largest, smallest, name o mtime")
+		os.Exit(1)
+	}
+	// Antes de gastar nada en el LLM: un -out imposible se descubría al final
+	if err := checkOutDir(*out, *mkdirOut); err != nil {
+		fmt.Fprintln(os.Stderr, "-out:", err)
+		os.Exit(1)
+	}
+	switch promptOpts.SummaryStyle {
+	case "oneline", "abstract", "bullets":
+	default:
+		fmt.Fprintln(os.Stderr, "-summary-style debe ser oneline, abstract o bullets")
+		os.Exit(1)
+	}
+	if promptOpts.NoKeywords && promptOpts.KeywordsOnly {
+		fmt.Fprintln(os.Stderr, "-no-keywords y -keywords-only son excluyentes")
+		os.Exit(1)
+	}
+
+	skipRe, err := compileRegex("skip-content-regex", *skipContent)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	onlyRe, err := compileRegex("content-regex", *onlyContent)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 
 	// Elegir summarizer
+	popts := providerOptions{
+		OpenAIAPI:        *openaiAPI,
+		Deterministic:    *deterministic,
+		RequireLLM:       *requireLLM,
+		OllamaNumCtx:     *ollamaNumCtx,
+		OllamaNumPredict: *ollamaNumPredict,
+		OllamaKeepAlive:  *ollamaKeepAlive,
+		ExecCmd:          *execCmd,
+		APIKeyFile:       *apiKeyFile,
+	}
 	provider := strings.ToLower(env("LLM_PROVIDER", "openai"))
 	model := env("LLM_MODEL", "gpt-4o-mini")
-	var s Summarizer
-	switch provider {
-	case "ollama":
-		s = &OllamaSummarizer{Base: env("OLLAMA_BASE", "http://localhost:11434")}
-	default: // openai compatible
-		apikey := os.Getenv("LLM_API_KEY")
-		if apikey == "" {
-			fmt.Fprintln(os.Stderr, "WARN: LLM_API_KEY vacío; se generará índice SIN resumen/keywords")
-			s = NoopSummarizer{}
-		} else {
-			s = &OpenAICompat{Base: env("OPENAI_BASE", "https://api.openai.com"), APIKey: apikey}
+	s, err := newSummarizer(provider, popts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	var embedder Embedder
+	if *embedModel != "" {
+		var ok bool
+		if embedder, ok = s.(Embedder); !ok {
+			fmt.Fprintln(os.Stderr, "-embed-model requiere un proveedor con embeddings (openai u ollama con credenciales)")
+			os.Exit(1)
+		}
+	}
+	if doctor {
+		if err := runDoctor(s, provider, model, *timeout); err != nil {
+			fmt.Fprintln(os.Stderr, "FALLO:", err)
+			os.Exit(1)
+		}
+		fmt.Println("OK")
+		return
+	}
+
+	// El limitador va por debajo del dedup: los duplicados en vuelo esperan
+	// sin ocupar cupo de concurrencia
+	var limiter *aimdLimiter
+	if *adaptive {
+		limiter = newAIMDLimiter(*workersMin, *workers)
+	}
+	tokenizerDir = *tokDir
+	if enc := encodingFor(model); tokenizerDir != "" && enc != "" {
+		if _, ok := tokenizerFor(model).(heuristicTokenizer); ok {
+			fmt.Fprintf(os.Stderr, "aviso: no se pudo cargar %s.tiktoken de %s; se estiman ~4 caracteres por token\n", enc, tokenizerDir)
+		}
+	}
+	var tokensUsed atomic.Int64
+	var audit *auditLog
+	if *auditPrompts != "" {
+		if audit, err = openAuditLog(*auditPrompts); err != nil {
+			fmt.Fprintln(os.Stderr, "-audit-prompts:", err)
+			os.Exit(1)
+		}
+		defer audit.Close()
+	}
+	var budget *atomic.Int64 // compartido entre rutas, como tokensUsed
+	if *retryBudget > 0 {
+		budget = new(atomic.Int64)
+		budget.Store(*retryBudget)
+	}
+	wrap := func(s Summarizer) Summarizer {
+		if audit != nil && !isExcerpt(s) {
+			s = &auditSummarizer{next: s, log: audit}
+		}
+		if !isExcerpt(s) {
+			s = &countingSummarizer{next: s}
+		}
+		if limiter != nil {
+			s = &adaptiveSummarizer{next: s, limiter: limiter}
+		}
+		if *retries > 0 {
+			s = &retrySummarizer{next: s, retries: *retries, base: *retryBase, max: *retryMax, jitter: *retryJitter, budget: budget}
+		}
+		if *maxTokens > 0 || *publish != "" {
+			s = &budgetSummarizer{next: s, max: *maxTokens, used: &tokensUsed}
+		}
+		if *dedup {
+			s = newDedupSummarizer(s)
+		}
+		if *cacheDir != "" && !isExcerpt(s) {
+			s = &cacheSummarizer{next: s, dir: *cacheDir}
+		}
+		return s
+	}
+	s = wrap(s)
+
+	// -route .go=ollama:codellama,.md=openai:gpt-4o
+	routes := map[string]route{}
+	for _, r := range splitList(*routeSpec) {
+		ext, target, ok := strings.Cut(r, "=")
+		if !ok {
+			fmt.Fprintln(os.Stderr, "-route: se esperaba .ext=proveedor[:modelo] en", r)
+			os.Exit(1)
+		}
+		prov, m, _ := strings.Cut(target, ":")
+		if !knownProviders[strings.ToLower(prov)] {
+			fmt.Fprintln(os.Stderr, "-route: proveedor desconocido:", prov)
+			os.Exit(1)
+		}
+		if m == "" {
+			m = model
+		}
+		rs, err := newSummarizer(strings.ToLower(prov), popts)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		routes[ext] = route{s: wrap(rs), model: m}
+	}
+
+	var models []string
+	if *compare != "" {
+		models = splitList(*compare)
+		model = strings.Join(models, ",")
+	}
+
+	// Índice previo (modos que reutilizan resultados de -out)
+	prior := map[string]IndexItem{}
+	var resumed []IndexItem // ítems previos anteriores a -resume-from
+	resume := filepath.ToSlash(filepath.Clean(*resumeFrom))
+	var since time.Time // -since-index: generated del índice previo
+	if *skipExisting || *retryErrors || *resumeFrom != "" || *sinceIndex != "" {
+		priorPath := *out
+		if *sinceIndex != "" {
+			priorPath = *sinceIndex
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), *loadTimeout)
+		old, err := loadIndex(ctx, priorPath)
+		cancel()
+		switch {
+		case errors.Is(err, os.ErrNotExist) && !*retryErrors && *resumeFrom == "":
+			// primera ejecución: nada que conservar
+		case err != nil:
+			fmt.Fprintln(os.Stderr, "no se pudo cargar el índice previo:", err)
+			os.Exit(1)
+		default:
+			if *sinceIndex != "" {
+				since = old.Generated
+			}
+			for _, it := range old.Items {
+				prior[it.Path] = it
+				if *resumeFrom != "" && walkBefore(it.Path, resume) {
+					resumed = append(resumed, it)
+				}
+			}
 		}
 	}
 
+	// Ítem previo que se conserva tal cual. Con -retry-errors lo que no
+	// estaba en el índice previo queda fuera (ok=false, retry=false). mod es
+	// la fecha de modificación actual (cero si no se conoce).
+	reuse := func(p string, mod time.Time) (old IndexItem, ok, retry bool) {
+		old, found := prior[p]
+		switch {
+		case *retryErrors:
+			return old, found && old.Error == "", found && old.Error != ""
+		case *skipExisting && found && old.Summary != "":
+			return old, true, false
+		case !since.IsZero() && found && !mod.IsZero() && !mod.After(since):
+			return old, true, false
+		}
+		return old, false, true
+	}
+
+	var lineNumberExts map[string]bool
+	if *lineNumbers {
+		lineNumberExts = toSet(*lineNumbersExt)
+	}
+	ix := &indexer{
+		s:                s,
+		model:            model,
+		models:           models,
+		routes:           routes,
+		skipRe:           skipRe,
+		onlyRe:           onlyRe,
+		stripHTML:        *stripHTMLFlag,
+		dedupLines:       *dedupLinesFlag,
+		collapseWS:       *collapseWS,
+		extractors:       *extractorsFlag,
+		checkKeywords:    *checkKeywords,
+		langHint:         *langHint,
+		mdTitle:          *mdTitle,
+		mdTitleContext:   *mdTitleContext,
+		symbols:          *symbols,
+		pathKeywords:     *pathKeywords,
+		lineNumbers:      lineNumberExts,
+		auditPrompts:     *auditPrompts != "",
+		jsonCompact:      *jsonCompact,
+		summaryMaxChars:  *summaryMax,
+		latin1Fallback:   *latin1,
+		keywordsMin:      *kwMin,
+		keywordsMax:      *kwMax,
+		keywordsBackfill: *kwBackfill,
+		timeout:          *timeout,
+		timeoutPerByte:   *timeoutPerByte,
+		timeoutMax:       *timeoutMax,
+	}
+	if embedder != nil {
+		if audit != nil {
+			embedder = &auditEmbedder{next: embedder, log: audit}
+		}
+		if *maxTokens > 0 || *publish != "" {
+			embedder = &budgetEmbedder{next: embedder, max: *maxTokens, used: &tokensUsed}
+		}
+		ix.embedder, ix.embedModel = embedder, *embedModel
+	}
+	if *breakerFailures > 0 {
+		ix.breaker = newCircuitBreaker(*breakerFailures, *breakerCooldown)
+	}
+	if *stripFM {
+		ix.frontmatter = splitList(*fmDelims)
+	}
+	previewCmds, err := parsePreviewCmds(previewCmdSpecs)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	var tags map[string]string
+	for _, t := range tagSpecs {
+		k, v, ok := strings.Cut(t, "=")
+		if !ok || strings.TrimSpace(k) == "" {
+			fmt.Fprintln(os.Stderr, "-tag: se esperaba clave=valor en", t)
+			os.Exit(1)
+		}
+		if tags == nil {
+			tags = map[string]string{}
+		}
+		tags[strings.TrimSpace(k)] = v
+	}
+	for _, h := range headerSpecs {
+		k, v, ok := strings.Cut(h, ":")
+		if !ok || strings.TrimSpace(k) == "" {
+			fmt.Fprintln(os.Stderr, "-header: se esperaba 'Nombre: valor' en", h)
+			os.Exit(1)
+		}
+		extraHeaders.Add(strings.TrimSpace(k), strings.TrimSpace(v))
+	}
 	exts := toSet(*include)
-	var items []IndexItem // make()
+	for ext := range previewCmds {
+		exts[ext] = true
+	}
+	// Patrones posicionales ('docs/**/*.md'): sustituyen a -include
+	globs := flag.Args()
+	if err := checkGlobs(globs); err != nil {
+		fmt.Fprintln(os.Stderr, "patrón inválido:", err)
+		os.Exit(1)
+	}
+	selected := func(rel string) bool {
+		if len(globs) == 0 {
+			return exts[strings.ToLower(filepath.Ext(rel))]
+		}
+		for _, g := range globs {
+			if matchGlob(filepath.ToSlash(g), rel) {
+				return true
+			}
+		}
+		return false
+	}
 
 	root, _ := filepath.Abs(*dir)
-	filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
-		if err != nil || d.IsDir() {
+	if *gitMeta && !isGitRepo(root) {
+		fmt.Fprintln(os.Stderr, "WARN: -git-meta ignorado;", root, "no es un repositorio git")
+		*gitMeta = false
+	}
+	// Marcas de tiempo en UTC con -utc para comparar índices entre máquinas
+	now := time.Now
+	if *utc {
+		now = func() time.Time { return time.Now().UTC() }
+	}
+
+	// Las rutas de ítems ya usan "/"; con -slash-paths también Dir, para
+	// que índices de Windows y Linux coincidan byte a byte
+	indexDir := root
+	if *slashPaths {
+		indexDir = filepath.ToSlash(root)
+	}
+	// Cabecera común del índice final, el parcial (-flush-interval) y -stream
+	newIndex := func(items []IndexItem) Index {
+		return Index{Dir: indexDir, Generated: now(), Model: model, EmbeddingModel: *embedModel, Items: items, Tags: tags, GeneratorVersion: generatorVersion()}
+	}
+
+	// Con -stream los ítems van al archivo según terminan (en orden de
+	// finalización); si no, se juntan en orden de recorrido
+	col := newCollector()
+	sink := col.add
+	var stream *streamWriter
+	if *streamOut {
+		stream, err = newStreamWriter(*out, newIndex(nil))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "write error:", err)
+			os.Exit(1)
+		}
+		sink = func(_ int, its []IndexItem) {
+			for _, it := range its {
+				if e := stream.write(it); e != nil {
+					fmt.Fprintln(os.Stderr, "stream:", it.Path, e)
+				}
+			}
+		}
+	}
+	if *synonymsFile != "" {
+		syn, err := loadSynonyms(*synonymsFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "keyword-synonyms:", err)
+			os.Exit(1)
+		}
+		next := sink
+		sink = func(seq int, its []IndexItem) {
+			for i := range its {
+				if its[i].Keywords != nil {
+					its[i].Keywords = canonicalKeywords(its[i].Keywords, syn)
+				}
+			}
+			next(seq, its)
+		}
+	}
+	if *utc {
+		next := sink
+		sink = func(seq int, its []IndexItem) {
+			for i := range its {
+				its[i].toUTC()
+			}
+			next(seq, its)
+		}
+	}
+	if len(resumed) > 0 {
+		metrics.Reused.Add(int64(len(resumed)))
+		sink(0, resumed)
+	}
+	jobs := make(chan job)
+	done := make(chan struct{})
+	go func() {
+		runPool(*workers, jobs, sink)
+		close(done)
+	}()
+
+	// Índice parcial en -out cada -flush-interval, para seguir el progreso
+	// desde fuera; se detiene antes de la escritura final
+	flushed := make(chan struct{})
+	if *flushInterval > 0 {
+		go func() {
+			defer close(flushed)
+			t := time.NewTicker(*flushInterval)
+			defer t.Stop()
+			for {
+				select {
+				case <-done:
+					return
+				case <-t.C:
+					partial := newIndex(col.items())
+					if err := writeJSON(*out, partial); err != nil {
+						fmt.Fprintln(os.Stderr, "flush:", err)
+					}
+				}
+			}
+		}()
+	} else {
+		close(flushed)
+	}
+
+	// Bytes que puede ocupar un preview leído del disco
+	previewLimit := int64(*maxBytes)
+	if *headBytes > 0 {
+		previewLimit = int64(*headBytes)
+	}
+	if *tailBytes > 0 {
+		previewLimit += int64(*tailBytes)
+	}
+	var inflight *byteSemaphore
+	if *maxInflight > 0 {
+		inflight = newByteSemaphore(*maxInflight)
+	}
+
+	// Leer hasta maxBytes (o -head-bytes/-tail-bytes); los de -tail-ext,
+	// desde el final
+	tailExts := toSet(*tailExt)
+	readPreview := func(path string, size int64) ([]byte, error) {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		if tailExts[strings.ToLower(filepath.Ext(path))] {
+			return readTail(f, size, *maxBytes)
+		}
+		switch *sample {
+		case "middle":
+			return readSample(f, size, *maxBytes, 1)
+		case "even":
+			return readSample(f, size, *maxBytes, *sampleWindows)
+		}
+		if *tailBytes > 0 {
+			// Principio y final (papers, informes con conclusiones)
+			head := *maxBytes
+			if *headBytes > 0 {
+				head = *headBytes
+			}
+			return readHeadTail(f, size, head, *tailBytes)
+		}
+		limit := *maxBytes
+		if *headBytes > 0 {
+			limit = *headBytes
+		}
+		return io.ReadAll(&io.LimitedReader{R: f, N: int64(limit)})
+	}
+
+	// Con -order los trabajos se acumulan y se reparten ordenados al acabar
+	// el recorrido; sin él van directos a los workers
+	var pending []pendingJob
+	submit := func(j job, rel string, d os.DirEntry) {
+		if *order == "" {
+			jobs <- j
+			return
+		}
+		p := pendingJob{job: j, name: rel}
+		if info, err := d.Info(); err == nil {
+			p.size, p.mod = info.Size(), info.ModTime()
+		}
+		pending = append(pending, p)
+	}
+	// Orden del recorrido: filepath.WalkDir (y walkDirParallel) lee cada
+	// directorio ordenado por nombre y baja en profundidad (walkBefore), así
+	// que es estable entre ejecuciones; -resume-from y el orden del índice
+	// dependen de ello
+	walk := filepath.WalkDir
+	if *walkConc > 1 {
+		walk = func(root string, fn fs.WalkDirFunc) error { return walkDirParallel(root, *walkConc, fn) }
+	}
+	// Salidas propias dentro del árbol: -out y, con -per-dir, los
+	// subíndices (<subdir>/<nombre de -out>). Sin esto cada ejecución
+	// resumiría las salidas de la anterior. Sin -per-dir un docs/index.json
+	// es un archivo más.
+	outAbs, _ := filepath.Abs(*out)
+	outName := filepath.Base(*out)
+	generatedOutput := func(path, rel string) bool {
+		if path == outAbs {
+			return true
+		}
+		dir, rest, ok := topDir(rel)
+		return *perDir && ok && dir != "" && rest == outName
+	}
+	queued := 0
+	var walkedDirs []string // subdirectorios de primer nivel (-include-empty-dirs)
+	walk(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
 			return nil
 		}
-		if !exts[strings.ToLower(filepath.Ext(path))] {
+		if d.IsDir() {
+			rel, _ := filepath.Rel(root, path)
+			rel = filepath.ToSlash(rel)
+			// Con -resume-from, directorios enteros anteriores ni se abren
+			if *resumeFrom != "" && rel != "." && walkBefore(rel, resume) && !strings.HasPrefix(resume, rel+"/") {
+				return filepath.SkipDir
+			}
+			if *emptyDirs && rel != "." && !strings.Contains(rel, "/") {
+				walkedDirs = append(walkedDirs, rel)
+			}
+			return nil
+		}
+		if *sidecars && strings.HasSuffix(path, sidecarSuffix) {
 			return nil
 		}
-
 		rel, _ := filepath.Rel(root, path)
-		info, e := os.Stat(path)
-		item := IndexItem{Path: filepath.ToSlash(rel)}
-		if e != nil {
-			item.Error = e.Error()
-			items = append(items, item)
+		rel = filepath.ToSlash(rel)
+		if generatedOutput(path, rel) {
 			return nil
 		}
-		item.Size = info.Size()
-		item.ModTime = info.ModTime()
-
-		// Leer hasta maxBytes
-		f, e := os.Open(path)
-		if e != nil {
-			item.Error = e.Error()
-			items = append(items, item)
+		if *resumeFrom != "" && walkBefore(rel, resume) {
 			return nil
 		}
-		defer f.Close()
-		lr := io.LimitedReader{R: f, N: int64(*maxBytes)}
-		b, e := io.ReadAll(&lr)
-		if e != nil {
-			item.Error = e.Error()
-			items = append(items, item)
+		inArchive := *archives && isArchive(path) && !*namesOnly
+		if !inArchive && !selected(rel) {
 			return nil
 		}
-		preview := string(b)
+		var mod time.Time
+		if !since.IsZero() {
+			if info, err := d.Info(); err == nil {
+				mod = info.ModTime()
+			}
+		}
+		old, ok, retry := reuse(rel, mod)
+		if !inArchive && !ok && !retry {
+			return nil
+		}
+		if *maxFiles > 0 && queued >= *maxFiles || ix.aborted() != nil {
+			return errStopWalk
+		}
+		seq := queued + 1 // 0 es para los ítems de -resume-from
+		queued++
 
-		// LLM (con timeout por archivo)
-		ctx, cancel := context.WithTimeout(context.Background(), *timeout)
-		defer cancel()
-		sum, kws, e := s.Summarize(ctx, model, rel, preview)
-		if e != nil {
-			item.Error = e.Error()
+		if inArchive {
+			// Entradas como "bundle.zip!docs/readme.md"
+			submit(job{seq, func() []IndexItem {
+				// Un FIFO llamado x.zip bloquearía zip.OpenReader
+				if info, e := os.Stat(path); e == nil && !info.Mode().IsRegular() {
+					return []IndexItem{{Path: rel, Note: "omitido: no es un archivo regular (" + info.Mode().Type().String() + ")"}}
+				}
+				if inflight != nil {
+					inflight.acquire(int64(*maxBytes))
+					defer inflight.release(int64(*maxBytes))
+				}
+				var items []IndexItem
+				e := walkArchive(path, exts, *maxBytes, func(ae archiveEntry) error {
+					item := IndexItem{Path: rel + "!" + ae.Name, Size: ae.Size, ModTime: ae.ModTime}
+					if old, ok, retry := reuse(item.Path, item.ModTime); ok || !retry {
+						if ok {
+							metrics.Reused.Add(1)
+							items = append(items, old)
+						}
+						return nil
+					}
+					if ix.process(&item, ae.Preview, nil) {
+						items = append(items, item)
+					}
+					return nil
+				})
+				if e != nil {
+					items = append(items, IndexItem{Path: rel, Error: e.Error()})
+				}
+				return items
+			}}, rel, d)
+			return nil
 		}
-		item.Summary = sum
-		item.Keywords = kws
-		items = append(items, item)
+		if ok {
+			metrics.Reused.Add(1)
+			submit(job{seq, func() []IndexItem { return []IndexItem{old} }}, rel, d)
+			return nil
+		}
+		submit(job{seq, func() []IndexItem {
+			item := IndexItem{Path: rel}
+			info, e := os.Stat(path)
+			if e != nil {
+				item.Error = e.Error()
+				return []IndexItem{item}
+			}
+			// FIFOs y dispositivos pueden bloquear ReadAll para siempre
+			if !info.Mode().IsRegular() {
+				item.Note = "omitido: no es un archivo regular (" + info.Mode().Type().String() + ")"
+				return []IndexItem{item}
+			}
+			item.Size = info.Size()
+			item.ModTime = info.ModTime()
+			if *gitMeta {
+				item.Git = gitLastCommit(root, path)
+			}
+			if *docIDScheme != "" {
+				if item.DocID, e = docID(*docIDScheme, path, rel); e != nil {
+					item.Error = e.Error()
+					return []IndexItem{item}
+				}
+			}
+			if *skipRatio > 0 && item.Size > *skipRatio*previewLimit {
+				item.Note = fmt.Sprintf("omitido: %d bytes, más de %d veces el preview (-skip-ratio)", item.Size, *skipRatio)
+				return []IndexItem{item}
+			}
+			if *namesOnly {
+				// Índice de navegación rápido, gratis y sin red
+				item.Keywords = pathTokens(rel)
+				return []IndexItem{item}
+			}
+
+			args, converted := previewCmds[strings.ToLower(filepath.Ext(path))]
+			if inflight != nil {
+				// Reservar antes de leer; se libera cuando el ítem termina
+				n := min(item.Size, previewLimit)
+				if tailExts[strings.ToLower(filepath.Ext(path))] {
+					n = min(item.Size, int64(*maxBytes))
+				}
+				if converted {
+					n = int64(*maxBytes)
+				}
+				inflight.acquire(n)
+				defer inflight.release(n)
+			}
+			var b []byte
+			if converted {
+				// Formatos propios (docx, odt...) vía conversor externo
+				b, e = runPreviewCmd(args, path, *maxBytes, *timeout)
+			} else {
+				b, e = readPreview(path, item.Size)
+			}
+			if e != nil {
+				item.Error = e.Error()
+				return []IndexItem{item}
+			}
+			var sc *sidecar
+			if *sidecars {
+				if sc, e = loadSidecar(path); e != nil {
+					item.Error = "sidecar: " + e.Error()
+					return []IndexItem{item}
+				}
+			}
+			if ix.process(&item, string(b), sc) {
+				return []IndexItem{item}
+			}
+			return nil
+		}}, rel, d)
 		return nil
 	})
+	sortJobs(pending, *order)
+	for _, p := range pending {
+		jobs <- p.job
+	}
+	close(jobs)
+	<-done
+	<-flushed
+
+	if err := ix.aborted(); err != nil {
+		if stream != nil {
+			stream.abort()
+		}
+		fmt.Fprintln(os.Stderr, "abortado: el proveedor rechazó las credenciales, revisa LLM_API_KEY:", err)
+		os.Exit(1)
+	}
 
-	idx := Index{
-		Dir:       root,
-		Generated: time.Now(),
-		Model:     model,
-		Items:     items,
+	if stream != nil {
+		if err := stream.close(); err != nil {
+			fmt.Fprintln(os.Stderr, "write error:", err)
+			os.Exit(1)
+		}
+		fmt.Println("OK →", *out, "items:", stream.n)
+		metrics.print()
+		return
+	}
+	items := col.items()
+	if *summaryDedup > 0 {
+		clusterSummaries(items, *summaryDedup)
+	}
+
+	idx := newIndex(items)
+	if *statsOut != "" {
+		// Antes de -group-by y -per-dir, que reparten los ítems
+		if err := writeJSON(*statsOut, corpusStats(idx)); err != nil {
+			fmt.Fprintln(os.Stderr, "stats:", err)
+			os.Exit(1)
+		}
+	}
+	if *groupBy != "" {
+		idx = groupIndex(idx, *groupBy)
+	}
+	// Con -keep-going-on-write-error los fallos de salidas individuales se
+	// informan al final en lugar de cortar la ejecución
+	var writeErrs []error
+	if *perDir {
+		// Los subíndices se bloquean con el lock de -out: nada de .lock en
+		// los directorios indexados
+		unlock, err := lockFile(*out + ".lock")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "write error:", err)
+			os.Exit(1)
+		}
+		idx, err = writePerDir(idx, filepath.Base(*out), *slashPaths, walkedDirs, *keepGoing)
+		unlock()
+		if err != nil {
+			if !*keepGoing {
+				fmt.Fprintln(os.Stderr, "write error:", err)
+				os.Exit(1)
+			}
+			writeErrs = append(writeErrs, err)
+		}
 	}
 	if err := writeJSON(*out, idx); err != nil {
 		fmt.Fprintln(os.Stderr, "write error:", err)
 		os.Exit(1)
 	}
+	if *perFileOut != "" {
+		if err := writePerFile(*perFileOut, items, *keepGoing); err != nil {
+			if !*keepGoing {
+				fmt.Fprintln(os.Stderr, "write error:", err)
+				os.Exit(1)
+			}
+			writeErrs = append(writeErrs, err)
+		}
+	}
+	if *publish != "" {
+		m := Manifest{
+			Generated:        idx.Generated,
+			GeneratorVersion: idx.GeneratorVersion,
+			Dir:              idx.Dir,
+			Provider:         provider,
+			Model:            model,
+			DurationMs:       time.Since(started).Milliseconds(),
+			TokensEstimated:  tokensUsed.Load(),
+			Reused:           metrics.Reused.Load(),
+			LLMCalls:         metrics.LLMCalls.Load(),
+			DedupHits:        metrics.DedupHits.Load(),
+			CacheHits:        metrics.CacheHits.Load(),
+			Flags:            map[string]string{},
+			Tags:             tags,
+		}
+		m.count(items)
+		flag.Visit(func(f *flag.Flag) { m.Flags[f.Name] = f.Value.String() })
+		if err := publishDir(*publish, filepath.Base(*out), idx, m); err != nil {
+			fmt.Fprintln(os.Stderr, "publish:", err)
+			os.Exit(1)
+		}
+		fmt.Println("publicado →", *publish)
+	}
 	fmt.Println("OK →", *out, "items:", len(items))
+	if err := errors.Join(writeErrs...); err != nil {
+		fmt.Fprintln(os.Stderr, "no se pudieron escribir algunas salidas:")
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	printTimings(items)
+	metrics.print()
+	if *maxTokens > 0 {
+		fmt.Printf("tokens estimados: %d de %d\n", tokensUsed.Load(), *maxTokens)
+	}
+	if limiter != nil {
+		fmt.Println("concurrencia adaptativa: límite final", limiter.current())
+	}
+}
+
+// Resume los tiempos de Summarize (p50/p95/max) para detectar archivos lentos
+func printTimings(items []IndexItem) {
+	var ms []int64
+	for _, it := range items {
+		if it.DurationMs > 0 {
+			ms = append(ms, it.DurationMs)
+		}
+	}
+	if len(ms) == 0 {
+		return
+	}
+	sort.Slice(ms, func(i, j int) bool { return ms[i] < ms[j] })
+	fmt.Printf("tiempos LLM (n=%d): p50=%dms p95=%dms max=%dms\n",
+		len(ms), percentile(ms, 50), percentile(ms, 95), ms[len(ms)-1])
 }
 
+// Percentil por rango más cercano sobre una lista ya ordenada
+func percentile(sorted []int64, p int) int64 {
+	i := (len(sorted)*p+99)/100 - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
+
+// Proveedores que acepta newSummarizer (cualquier otro cae en openai)
+var knownProviders = map[string]bool{"openai": true, "ollama": true, "exec": true, "mock": true}
+
+// Opciones comunes al construir summarizers
+type providerOptions struct {
+	OpenAIAPI     string // -openai-api
+	Deterministic bool
+	RequireLLM    bool   // error en vez de NoopSummarizer sin credenciales
+	APIKeyFile    string // -api-key-file: manda sobre LLM_API_KEY
+
+	OllamaNumCtx     int
+	OllamaNumPredict int
+	OllamaKeepAlive  string
+
+	ExecCmd string // comando del proveedor exec
+}
+
+// Construye el summarizer de un proveedor con la configuración del entorno
+func newSummarizer(provider string, o providerOptions) (Summarizer, error) {
+	switch provider {
+	case "mock":
+		return MockSummarizer{}, nil
+	case "exec":
+		args := strings.Fields(o.ExecCmd)
+		if len(args) == 0 {
+			return nil, errors.New("LLM_PROVIDER=exec requiere -exec-cmd")
+		}
+		return &ExecSummarizer{Command: args}, nil
+	case "ollama":
+		return &OllamaSummarizer{
+			Base:          env("OLLAMA_BASE", "http://localhost:11434"),
+			Deterministic: o.Deterministic,
+			NumCtx:        o.OllamaNumCtx,
+			NumPredict:    o.OllamaNumPredict,
+			KeepAlive:     o.OllamaKeepAlive,
+		}, nil
+	}
+	// openai compatible (default)
+	apikey := os.Getenv("LLM_API_KEY")
+	if o.APIKeyFile != "" {
+		// Fuera del entorno no aparece en /proc/<pid>/environ ni en volcados
+		b, err := os.ReadFile(o.APIKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("-api-key-file: %w", err)
+		}
+		if apikey = strings.TrimSpace(string(b)); apikey == "" {
+			return nil, fmt.Errorf("-api-key-file: %s está vacío", o.APIKeyFile)
+		}
+	}
+	if apikey == "" {
+		if o.RequireLLM {
+			return nil, errors.New("LLM_API_KEY vacío y -require-llm activo; abortando")
+		}
+		fmt.Fprintln(os.Stderr, "WARN: LLM_API_KEY vacío; se generará índice SIN resumen/keywords")
+		return NoopSummarizer{}, nil
+	}
+	return &OpenAICompat{Base: env("OPENAI_BASE", "https://api.openai.com"), APIKey: apikey, API: o.OpenAIAPI, Deterministic: o.Deterministic}, nil
+}
 
+// Sin proveedor: el "resumen" son las primeras 50 palabras del archivo
+// (los ítems llevan summary_kind "excerpt")
 type NoopSummarizer struct{}
 
 func (NoopSummarizer) Summarize(ctx context.Context, model, filename, preview string) (string, []string, error) {
@@ -141,33 +1154,78 @@ func (NoopSummarizer) Summarize(ctx context.Context, model, filename, preview st
 	return s, []string{"texto", "sin-llm"}, nil
 }
 
-// OpenAI compatible (Chat Completions)
+// Proveedor de pruebas sin red (LLM_PROVIDER=mock): el resumen sale del
+// hash del contenido y las keywords son fijas, así que dos ejecuciones
+// sobre el mismo árbol dan el mismo índice
+type MockSummarizer struct{}
+
+func (MockSummarizer) Summarize(ctx context.Context, model, filename, preview string) (string, []string, error) {
+	h := sha256.Sum256([]byte(preview))
+	sum := fmt.Sprintf("Resumen simulado del contenido %x (%d palabras, %d líneas).",
+		h[:4], len(strings.Fields(preview)), strings.Count(strings.TrimRight(preview, "\n"), "\n")+1)
+	return sum, []string{"mock", "prueba"}, nil
+}
+
+// Si s (quitando los envoltorios de dedup, presupuesto...) es el
+// NoopSummarizer, que solo devuelve un extracto
+func isExcerpt(s Summarizer) bool {
+	for {
+		switch w := s.(type) {
+		case NoopSummarizer:
+			return true
+		case interface{ Unwrap() Summarizer }:
+			s = w.Unwrap()
+		default:
+			return false
+		}
+	}
+}
+
+// OpenAI compatible (Chat Completions o Responses API)
 type OpenAICompat struct {
 	Base   string
 	APIKey string
+	API    string // "chat" (default) o "responses"
+	// Temperatura 0 y seed fija (la Responses API no acepta seed)
+	Deterministic bool
 }
 
 func (c *OpenAICompat) Summarize(ctx context.Context, model, filename, preview string) (string, []string, error) {
-	body := map[string]any{
-		"model": model,
-		"messages": []map[string]string{
-			{"role": "system", "content": "Responde SOLO un JSON: {\"summary\": \"...\", \"keywords\": [\"...\"]}"},
-			{"role": "user", "content": prompt(filename, preview)},
-		},
-		"temperature": 0.2,
+	msgs := []map[string]string{
+		{"role": "system", "content": "Responde SOLO un JSON: " + outputShape("...", "...")},
+		{"role": "user", "content": prompt(ctx, filename, preview)},
 	}
-	b, _ := json.Marshal(body)
-	req, _ := http.NewRequestWithContext(ctx, "POST", strings.TrimRight(c.Base, "/")+"/v1/chat/completions", strings.NewReader(string(b)))
-	req.Header.Set("Authorization", "Bearer "+c.APIKey)
-	req.Header.Set("Content-Type", "application/json")
-	resp, err := http.DefaultClient.Do(req)
+	send := c.chat
+	if c.API == "responses" {
+		send = c.respond
+	}
+	text, err := send(ctx, model, msgs)
 	if err != nil {
 		return "", nil, err
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode/100 != 2 {
-		d, _ := io.ReadAll(resp.Body)
-		return "", nil, fmt.Errorf("http %d: %s", resp.StatusCode, strings.TrimSpace(string(d)))
+	sum, kws, err := parseJSON(text)
+	if errors.Is(err, ErrParse) && promptOpts.Reprompt {
+		msgs = append(msgs,
+			map[string]string{"role": "assistant", "content": text},
+			map[string]string{"role": "user", "content": repromptText()})
+		if text, err = send(ctx, model, msgs); err != nil {
+			return "", nil, err
+		}
+		return parseJSON(text)
+	}
+	return sum, kws, err
+}
+
+// /v1/chat/completions; devuelve el contenido del primer choice
+func (c *OpenAICompat) chat(ctx context.Context, model string, msgs []map[string]string) (string, error) {
+	body := map[string]any{
+		"model":       model,
+		"messages":    msgs,
+		"temperature": 0.2,
+	}
+	if c.Deterministic {
+		body["temperature"] = 0
+		body["seed"] = deterministicSeed
 	}
 	var out struct {
 		Choices []struct {
@@ -176,76 +1234,378 @@ func (c *OpenAICompat) Summarize(ctx context.Context, model, filename, preview s
 			} `json:"message"`
 		} `json:"choices"`
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
-		return "", nil, err
+	if err := postJSON(ctx, strings.TrimRight(c.Base, "/")+"/v1/chat/completions", c.header(), body, &out); err != nil {
+		return "", err
 	}
 	if len(out.Choices) == 0 {
-		return "", nil, errors.New("sin choices")
+		return "", fmt.Errorf("%w: sin choices", ErrParse)
+	}
+	return out.Choices[0].Message.Content, nil
+}
+
+// /v1/responses con salida estructurada (json_schema estricto). El primer
+// mensaje (system) va como instructions y el resto como input.
+func (c *OpenAICompat) respond(ctx context.Context, model string, msgs []map[string]string) (string, error) {
+	body := map[string]any{
+		"model":        model,
+		"instructions": msgs[0]["content"],
+		"input":        msgs[1:],
+		"temperature":  0.2,
+		"text": map[string]any{
+			"format": map[string]any{
+				"type":   "json_schema",
+				"name":   "index_item",
+				"strict": true,
+				"schema": outputSchema(),
+			},
+		},
+	}
+	if c.Deterministic {
+		body["temperature"] = 0
+	}
+	var out struct {
+		Output []struct {
+			Type    string `json:"type"`
+			Content []struct {
+				Type string `json:"type"`
+				Text string `json:"text"`
+			} `json:"content"`
+		} `json:"output"`
+	}
+	if err := postJSON(ctx, strings.TrimRight(c.Base, "/")+"/v1/responses", c.header(), body, &out); err != nil {
+		return "", err
+	}
+	var text strings.Builder
+	for _, o := range out.Output {
+		if o.Type != "message" {
+			continue
+		}
+		for _, part := range o.Content {
+			if part.Type == "output_text" {
+				text.WriteString(part.Text)
+			}
+		}
+	}
+	if text.Len() == 0 {
+		return "", fmt.Errorf("%w: sin output_text", ErrParse)
 	}
-	return parseJSON(out.Choices[0].Message.Content)
+	return text.String(), nil
 }
 
+func (c *OpenAICompat) header() http.Header {
+	h := http.Header{}
+	h.Set("Authorization", "Bearer "+c.APIKey)
+	return h
+}
 
-type OllamaSummarizer struct{ Base string }
+type OllamaSummarizer struct {
+	Base          string
+	Deterministic bool   // temperature 0 y seed fija en options
+	NumCtx        int    // options.num_ctx (0 = el del modelo)
+	NumPredict    int    // options.num_predict (0 = sin tope)
+	KeepAlive     string // keep_alive, p. ej. "10m" ("" = default del servidor)
+}
 
 func (o *OllamaSummarizer) Summarize(ctx context.Context, model, filename, preview string) (string, []string, error) {
 	if model == "" {
 		model = "llama3.1:8b"
 	}
-	body := map[string]any{"model": model, "prompt": prompt(filename, preview), "stream": false}
-	b, _ := json.Marshal(body)
-	req, _ := http.NewRequestWithContext(ctx, "POST", strings.TrimRight(o.Base, "/")+"/api/generate", strings.NewReader(string(b)))
-	req.Header.Set("Content-Type", "application/json")
-	resp, err := http.DefaultClient.Do(req)
+	p := prompt(ctx, filename, preview)
+	text, err := o.generate(ctx, model, p)
 	if err != nil {
 		return "", nil, err
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode/100 != 2 {
-		d, _ := io.ReadAll(resp.Body)
-		return "", nil, fmt.Errorf("http %d: %s", resp.StatusCode, strings.TrimSpace(string(d)))
+	sum, kws, err := parseJSON(text)
+	if errors.Is(err, ErrParse) && promptOpts.Reprompt {
+		p += "\n\nTu respuesta:\n" + text + "\n\n" + repromptText()
+		if text, err = o.generate(ctx, model, p); err != nil {
+			return "", nil, err
+		}
+		return parseJSON(text)
+	}
+	return sum, kws, err
+}
+
+// /api/generate sin streaming; devuelve el texto generado
+func (o *OllamaSummarizer) generate(ctx context.Context, model, prompt string) (string, error) {
+	body := map[string]any{"model": model, "prompt": prompt, "stream": false}
+	opts := map[string]any{}
+	if o.Deterministic {
+		opts["temperature"] = 0
+		opts["seed"] = deterministicSeed
+	}
+	if o.NumCtx > 0 {
+		opts["num_ctx"] = o.NumCtx
+	}
+	if o.NumPredict > 0 {
+		opts["num_predict"] = o.NumPredict
+	}
+	if len(opts) > 0 {
+		body["options"] = opts
+	}
+	if o.KeepAlive != "" {
+		body["keep_alive"] = o.KeepAlive
 	}
 	var out struct {
 		Response string `json:"response"`
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+	if err := postJSON(ctx, strings.TrimRight(o.Base, "/")+"/api/generate", nil, body, &out); err != nil {
+		return "", err
+	}
+	return out.Response, nil
+}
+
+// Delegar en un comando externo: recibe el nombre del archivo como último
+// argumento y el preview por stdin; su stdout debe ser el mismo JSON
+// {"summary": ..., "keywords": [...]} que se pide a los modelos
+type ExecSummarizer struct {
+	Command []string
+}
+
+func (x *ExecSummarizer) Summarize(ctx context.Context, model, filename, preview string) (string, []string, error) {
+	cmd := commandContext(ctx, x.Command[0], append(x.Command[1:], filename)...)
+	// Al comando solo le llega el preview por stdin
+	if err := auditRequest(ctx, strings.Join(cmd.Args, " "), []byte(preview)); err != nil {
 		return "", nil, err
 	}
-	return parseJSON(out.Response)
+	cmd.Stdin = strings.NewReader(preview)
+	cmd.Env = append(os.Environ(), "LLM_MODEL="+model)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return "", nil, wrapTimeout(ctx.Err())
+		}
+		return "", nil, fmt.Errorf("exec %s: %w: %s", x.Command[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return parseJSON(stdout.String())
+}
+
+// Cliente HTTP compartido por los proveedores; su Transport se ajusta con
+// -max-conns-per-host / -max-idle-conns-per-host
+var httpTransport = http.DefaultTransport.(*http.Transport).Clone()
+var httpClient = &http.Client{Transport: httpTransport}
+
+// Cabeceras de -header para gateways (tenant, región...): van en todas las
+// peticiones y pisan las del proveedor salvo Content-Type
+var extraHeaders = http.Header{}
+
+// POST de un cuerpo JSON; decodifica la respuesta 2xx en out
+func postJSON(ctx context.Context, url string, hdr http.Header, body, out any) error {
+	b, _ := json.Marshal(body)
+	if err := auditRequest(ctx, url, b); err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	for k, v := range hdr {
+		req.Header[k] = v
+	}
+	for k, v := range extraHeaders {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return wrapTimeout(err)
+	}
+	defer resp.Body.Close()
+	// Sin leer más de maxResponseBytes aunque el modelo se desboque
+	d, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes+1))
+	if err != nil {
+		return wrapTimeout(err)
+	}
+	tooBig := int64(len(d)) > maxResponseBytes
+	if tooBig {
+		d = d[:maxResponseBytes]
+	}
+	if resp.StatusCode/100 != 2 {
+		return &httpError{Status: resp.StatusCode, Body: strings.TrimSpace(string(d)), Header: debugHeaders(resp.Header)}
+	}
+	if tooBig {
+		return fmt.Errorf("respuesta de más de %d bytes (-max-response-bytes)", maxResponseBytes)
+	}
+	if len(bytes.TrimSpace(d)) == 0 {
+		return ErrEmptyResponse
+	}
+	if err := json.Unmarshal(d, out); err != nil {
+		return fmt.Errorf("%w: %w", ErrParse, err)
+	}
+	return nil
+}
+
+// Tope del cuerpo de respuesta del proveedor (-max-response-bytes)
+var maxResponseBytes int64 = 8 << 20
+
+// Cabeceras útiles para depurar rate limits con el proveedor
+var debugHeaderNames = []string{
+	"Retry-After",
+	"X-Request-Id",
+	"X-Ratelimit-Limit-Requests",
+	"X-Ratelimit-Remaining-Requests",
+	"X-Ratelimit-Reset-Requests",
+	"X-Ratelimit-Limit-Tokens",
+	"X-Ratelimit-Remaining-Tokens",
+	"X-Ratelimit-Reset-Tokens",
+}
+
+// Respuesta no-2xx del proveedor, con las cabeceras de depuración presentes
+type httpError struct {
+	Status int
+	Body   string
+	Header http.Header
+}
+
+func (e *httpError) Error() string {
+	msg := fmt.Sprintf("http %d: %s", e.Status, e.Body)
+	var hs []string
+	for _, k := range debugHeaderNames {
+		if v := e.Header.Get(k); v != "" {
+			hs = append(hs, strings.ToLower(k)+"="+v)
+		}
+	}
+	if len(hs) > 0 {
+		msg += " [" + strings.Join(hs, " ") + "]"
+	}
+	return msg
 }
 
+func debugHeaders(h http.Header) http.Header {
+	out := http.Header{}
+	for _, k := range debugHeaderNames {
+		if v := h.Get(k); v != "" {
+			out.Set(k, v)
+		}
+	}
+	return out
+}
 
-func prompt(filename, preview string) string {
+func prompt(ctx context.Context, filename, preview string) string {
 	if len(preview) > 6000 {
 		preview = preview[:6000]
 	}
 	return fmt.Sprintf(`Archivo: %s
-Devuelve SOLO:
-{"summary":"resumen en 1-2 frases, 40-80 palabras, sin saltos","keywords":["5-10 en minúsculas"]}
+%sDevuelve SOLO:
+%s
 Texto:
-%s`, filename, preview)
+%s`, filename, langInstruction(ctx), outputShape(summaryHint(), "5-10 en minúsculas"), preview)
+}
+
+// Forma del resumen pedida según -summary-style
+func summaryHint() string {
+	switch promptOpts.SummaryStyle {
+	case "oneline":
+		return "una sola línea tipo título, máximo 12 palabras"
+	case "bullets":
+		return "3-5 viñetas que empiezan con - separadas por \\n"
+	}
+	return "resumen en 1-2 frases, 40-80 palabras, sin saltos"
+}
+
+// Instrucción de corrección para -reprompt
+func repromptText() string {
+	return "Tu respuesta anterior no era JSON válido. Devuelve SOLO el JSON, sin texto adicional: " + outputShape("...", "...")
+}
+
+// Forma del JSON que se pide al modelo según -no-keywords / -keywords-only
+func outputShape(summaryHint, keywordsHint string) string {
+	switch {
+	case promptOpts.NoKeywords:
+		return fmt.Sprintf(`{"summary":"%s"}`, summaryHint)
+	case promptOpts.KeywordsOnly:
+		return fmt.Sprintf(`{"keywords":["%s"]}`, keywordsHint)
+	}
+	return fmt.Sprintf(`{"summary":"%s","keywords":["%s"]}`, summaryHint, keywordsHint)
+}
+
+// JSON Schema equivalente a outputShape, para salidas estructuradas
+func outputSchema() map[string]any {
+	props := map[string]any{}
+	if !promptOpts.KeywordsOnly {
+		props["summary"] = map[string]any{"type": "string"}
+	}
+	if !promptOpts.NoKeywords {
+		props["keywords"] = map[string]any{"type": "array", "items": map[string]any{"type": "string"}}
+	}
+	required := make([]string, 0, len(props))
+	for k := range props {
+		required = append(required, k)
+	}
+	sort.Strings(required)
+	return map[string]any{
+		"type":                 "object",
+		"properties":           props,
+		"required":             required,
+		"additionalProperties": false,
+	}
 }
 
 func parseJSON(s string) (string, []string, error) {
 	s = strings.TrimSpace(s)
-	// recortar fences ```json ... ```
-	if i := strings.Index(s, "{"); i >= 0 {
-		if j := strings.LastIndex(s, "}"); j > i {
-			s = s[i : j+1]
+	if s == "" {
+		return "", nil, ErrEmptyResponse
+	}
+	// recortar fences ```json ... ``` (salvo en modo estricto)
+	if !promptOpts.StrictJSON {
+		if i := strings.Index(s, "{"); i >= 0 {
+			if j := strings.LastIndex(s, "}"); j > i {
+				s = s[i : j+1]
+			}
 		}
 	}
 
 	// Unmarshal el JSON en una estructura temporal
 	var tmp struct {
-		Summary  string   `json:"summary"`
-		Keywords []string `json:"keywords"`
+		Summary  json.RawMessage `json:"summary"`
+		Keywords []string        `json:"keywords"`
 	}
 	if err := json.Unmarshal([]byte(s), &tmp); err != nil {
-		return "", nil, err
+		return "", nil, fmt.Errorf("%w: %w", ErrParse, err)
 	}
-	return tmp.Summary, tmp.Keywords, nil
+	var sum string
+	if len(tmp.Summary) > 0 && json.Unmarshal(tmp.Summary, &sum) != nil {
+		// Con bullets algunos modelos devuelven un array de viñetas
+		var lines []string
+		if err := json.Unmarshal(tmp.Summary, &lines); err != nil {
+			return "", nil, fmt.Errorf("%w: summary: %w", ErrParse, err)
+		}
+		sum = strings.Join(lines, "\n")
+	}
+	return styleSummary(sum), tmp.Keywords, nil
 }
 
+// Normaliza el resumen al -summary-style: una línea, o una viñeta "- "
+// por línea con bullets
+func styleSummary(s string) string {
+	switch promptOpts.SummaryStyle {
+	case "oneline":
+		return strings.Join(strings.Fields(s), " ")
+	case "bullets":
+		var out []string
+		for _, l := range strings.Split(s, "\n") {
+			l = strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(l), "-*•"))
+			if l != "" {
+				out = append(out, "- "+l)
+			}
+		}
+		return strings.Join(out, "\n")
+	}
+	return s
+}
+
+// Divide una lista separada por comas descartando vacíos
+func splitList(csv string) []string {
+	var out []string
+	for _, e := range strings.Split(csv, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			out = append(out, e)
+		}
+	}
+	return out
+}
 
 func toSet(csv string) map[string]bool {
 	m := map[string]bool{}
@@ -262,6 +1622,18 @@ func toSet(csv string) map[string]bool {
 	return m
 }
 
+// Compila la regex de un flag; vacío significa "sin filtro" (nil)
+func compileRegex(name, expr string) (*regexp.Regexp, error) {
+	if expr == "" {
+		return nil, nil
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("regex inválida en -%s: %w", name, err)
+	}
+	return re, nil
+}
+
 // Utilidad para obtener variables de entorno
 func env(k, def string) string {
 	v := os.Getenv(k)
@@ -271,19 +1643,237 @@ func env(k, def string) string {
 	return v
 }
 
-// Escribe un JSON en un archivo temporal y lo renombra
+// Carga KEY=VALUE de un archivo .env sin pisar variables ya definidas
+func loadEnvFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		k, v, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		k = strings.TrimSpace(k)
+		v = strings.Trim(strings.TrimSpace(v), `"'`)
+		if _, set := os.LookupEnv(k); !set {
+			os.Setenv(k, v)
+		}
+	}
+	return sc.Err()
+}
+
+// Indica si un flag se pasó explícitamente en la línea de comandos
+func flagSet(name string) bool {
+	found := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			found = true
+		}
+	})
+	return found
+}
+
+// Carga un índice JSON existente. La lectura corre aparte para que ctx
+// pueda acotarla (p. ej. un sistema de archivos de red colgado).
+func loadIndex(ctx context.Context, path string) (*Index, error) {
+	type result struct {
+		idx *Index
+		err error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			ch <- result{nil, err}
+			return
+		}
+		var idx Index
+		if err := json.Unmarshal(b, &idx); err != nil {
+			ch <- result{nil, fmt.Errorf("%s: %w", path, err)}
+			return
+		}
+		ch <- result{&idx, nil}
+	}()
+	select {
+	case r := <-ch:
+		return r.idx, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Escribe un JSON en un archivo temporal y lo renombra.
+// El rename final se hace con un lock exclusivo sobre <path>.lock para
+// serializar ejecuciones concurrentes sobre el mismo -out.
 func writeJSON(path string, v any) error {
-	tmp := path + ".tmp"
-	f, err := os.Create(tmp)
+	tmp, err := writeTemp(path, v)
+	if err != nil {
+		return err
+	}
+	unlock, err := lockFile(path + ".lock")
 	if err != nil {
+		os.Remove(tmp)
 		return err
 	}
+	defer unlock()
+	return os.Rename(tmp, path)
+}
+
+// Comprueba que se podrá escribir path: su directorio existe (o se crea
+// con mkdir) y admite archivos nuevos, y path no es un directorio
+func checkOutDir(path string, mkdir bool) error {
+	dir := filepath.Dir(path)
+	if mkdir {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+	info, err := os.Stat(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("no existe el directorio %s (usa -mkdir para crearlo)", dir)
+	}
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s no es un directorio", dir)
+	}
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return fmt.Errorf("%s es un directorio", path)
+	}
+	f, err := os.CreateTemp(dir, ".textindexer-*")
+	if err != nil {
+		return fmt.Errorf("no se puede escribir en %s: %w", dir, err)
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// JSON indentado (por defecto) o compacto con -pretty=false
+var prettyJSON = true
+
+// -keep-tmp-on-error: conservar un .tmp parcial si falla la serialización
+var keepTmpOnError bool
+
+// Codifica v en un temporal junto a path y devuelve su nombre. El
+// temporal lleva PID y marca de tiempo para que dos ejecuciones
+// concurrentes no compartan el mismo .tmp.
+func writeTemp(path string, v any) (string, error) {
+	tmp := fmt.Sprintf("%s.%d.%d.tmp", path, os.Getpid(), time.Now().UnixNano())
+	f, err := os.OpenFile(tmp, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o666)
+	if err != nil {
+		return "", err
+	}
 	defer f.Close()
 	enc := json.NewEncoder(f)
-	enc.SetIndent("", "  ")
-	if err := enc.Encode(v); err != nil {
+	if prettyJSON {
+		enc.SetIndent("", "  ")
+	}
+	// El diagnóstico y el rescate trabajan sobre el valor original, no
+	// sobre su forma canónica
+	out := func(v any) any {
+		if canonicalJSON {
+			return canonical(reflect.ValueOf(v))
+		}
+		return v
+	}
+	if err := enc.Encode(out(v)); err != nil {
+		err = encodeError(v, err)
+		if idx, ok := v.(Index); ok && keepTmpOnError {
+			// Rescate: lo serializable se conserva y el resto queda marcado
+			if enc.Encode(out(salvageIndex(idx))) == nil {
+				f.Close()
+				return "", fmt.Errorf("%w (índice parcial en %s)", err, tmp)
+			}
+		}
+		f.Close()
+		os.Remove(tmp)
+		return "", err
+	}
+	return tmp, f.Close()
+}
+
+// Con Encode un error de serialización no dice en qué ítem ni en qué campo
+// ha fallado; se busca el primero
+func encodeError(v any, err error) error {
+	idx, ok := v.(Index)
+	if !ok {
 		return err
 	}
-	f.Close()
-	return os.Rename(tmp, path)
+	for _, it := range idx.Items {
+		if field, e := itemEncodeError(it); e != nil {
+			return fmt.Errorf("ítem %s, campo %s: %w", it.Path, field, e)
+		}
+	}
+	return err
+}
+
+// Primer campo de it que no se puede serializar (por su nombre JSON)
+func itemEncodeError(it IndexItem) (string, error) {
+	if _, err := json.Marshal(it); err == nil {
+		return "", nil
+	}
+	rv := reflect.ValueOf(it)
+	for i := 0; i < rv.NumField(); i++ {
+		if _, err := json.Marshal(rv.Field(i).Interface()); err != nil {
+			name, _, _ := strings.Cut(rv.Type().Field(i).Tag.Get("json"), ",")
+			return name, err
+		}
+	}
+	_, err := json.Marshal(it)
+	return "?", err
+}
+
+// Copia de idx con los ítems no serializables reducidos a ruta y error
+func salvageIndex(idx Index) Index {
+	items := make([]IndexItem, len(idx.Items))
+	for i, it := range idx.Items {
+		if field, err := itemEncodeError(it); err != nil {
+			it = IndexItem{Path: it.Path, Size: it.Size, ModTime: it.ModTime, Error: "no serializable (" + field + "): " + err.Error()}
+		}
+		items[i] = it
+	}
+	idx.Items = items
+	return idx
+}
+
+// Escribe un JSON por ítem en dir/<path>.json, replicando subdirectorios
+func writePerFile(dir string, items []IndexItem, keepGoing bool) error {
+	var errs []error
+	for _, it := range items {
+		if err := writeItemFile(dir, it); err != nil {
+			if !keepGoing {
+				return err
+			}
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func writeItemFile(dir string, it IndexItem) error {
+	target := filepath.Join(dir, filepath.FromSlash(it.Path)+".json")
+	if rel, err := filepath.Rel(dir, target); err != nil || !filepath.IsLocal(rel) {
+		return fmt.Errorf("%s: la ruta sale de %s", it.Path, dir)
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+	tmp, err := writeTemp(target, it)
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, target); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
 }
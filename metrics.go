@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+)
+
+// Contadores de una ejecución para ver si la reutilización (índice previo,
+// dedup) está ahorrando llamadas. Se actualizan desde varios workers.
+type runMetrics struct {
+	Reused    atomic.Int64 // ítems conservados del índice previo
+	LLMCalls  atomic.Int64 // llamadas que llegaron al proveedor
+	DedupHits atomic.Int64 // resúmenes compartidos con un duplicado (-dedup)
+	CacheHits atomic.Int64 // resúmenes sacados de -cache-dir
+}
+
+var metrics runMetrics
+
+// Línea de resumen al final de la ejecución (nada si no hubo actividad)
+func (m *runMetrics) print() {
+	r, c, d, h := m.Reused.Load(), m.LLMCalls.Load(), m.DedupHits.Load(), m.CacheHits.Load()
+	if r+c+d+h == 0 {
+		return
+	}
+	fmt.Printf("reutilizados del índice previo: %d, de la caché: %d, llamadas al LLM: %d, duplicados compartidos: %d\n", r, h, c, d)
+}
+
+// Cuenta las llamadas que llegan al proveedor: va por debajo de dedup y
+// presupuesto, así que lo que estos resuelven no cuenta
+type countingSummarizer struct {
+	next Summarizer
+}
+
+func (c *countingSummarizer) Summarize(ctx context.Context, model, filename, preview string) (string, []string, error) {
+	metrics.LLMCalls.Add(1)
+	return c.next.Summarize(ctx, model, filename, preview)
+}
+
+func (c *countingSummarizer) Unwrap() Summarizer { return c.next }
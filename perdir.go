@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Directorio de primer nivel de una ruta del índice y el resto relativo a
+// él. Para entradas de comprimidos solo cuenta la parte antes de "!".
+func topDir(p string) (dir, rest string, ok bool) {
+	outer := p
+	if i := strings.Index(p, "!"); i >= 0 {
+		outer = p[:i]
+	}
+	i := strings.Index(outer, "/")
+	if i < 0 {
+		return "", p, false
+	}
+	return p[:i], p[i+1:], true
+}
+
+// Escribe un índice por cada subdirectorio de primer nivel
+// (<root>/<dir>/<name>) y devuelve el índice raíz: los ítems de la raíz
+// más las rutas de los subíndices. emptyDirs son directorios recorridos que
+// también reciben índice (vacío) aunque no tengan ítems (-include-empty-dirs).
+// Con keepGoing un subíndice que no se puede escribir no detiene los demás:
+// queda fuera del índice raíz y su error se devuelve junto al resto.
+func writePerDir(idx Index, name string, slash bool, emptyDirs []string, keepGoing bool) (Index, error) {
+	byDir := map[string][]IndexItem{}
+	var rootItems []IndexItem
+	for _, it := range idx.Items {
+		dir, rest, ok := topDir(it.Path)
+		if !ok {
+			rootItems = append(rootItems, it)
+			continue
+		}
+		it.Path = rest
+		byDir[dir] = append(byDir[dir], it)
+	}
+	for _, d := range emptyDirs {
+		if _, ok := byDir[d]; !ok {
+			byDir[d] = []IndexItem{}
+		}
+	}
+
+	dirs := make([]string, 0, len(byDir))
+	for d := range byDir {
+		dirs = append(dirs, d)
+	}
+	sort.Strings(dirs)
+
+	rollup := idx
+	rollup.Items = rootItems
+	var errs []error
+	for _, d := range dirs {
+		sub := idx
+		sub.Dir = filepath.Join(idx.Dir, filepath.FromSlash(d))
+		if slash {
+			sub.Dir = filepath.ToSlash(sub.Dir)
+		}
+		sub.Items = byDir[d]
+		target := filepath.Join(filepath.FromSlash(idx.Dir), filepath.FromSlash(d), name)
+		if err := replaceJSON(target, sub); err != nil {
+			if !keepGoing {
+				return rollup, err
+			}
+			errs = append(errs, err)
+			continue
+		}
+		rollup.Subindexes = append(rollup.Subindexes, d+"/"+name)
+	}
+	return rollup, errors.Join(errs...)
+}
+
+// writeJSON sin lock propio (el llamador tiene el de -out): temporal y rename
+func replaceJSON(path string, v any) error {
+	tmp, err := writeTemp(path, v)
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Trabajo del recorrido: produce los ítems de un archivo (o de todas las
+// entradas de un comprimido). seq conserva el orden del recorrido.
+type job struct {
+	seq int
+	run func() []IndexItem
+}
+
+// Ejecuta los trabajos con n workers y entrega cada resultado a sink
+// (las llamadas a sink se serializan)
+func runPool(n int, jobs <-chan job, sink func(seq int, items []IndexItem)) {
+	if n < 1 {
+		n = 1
+	}
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				its := j.run()
+				mu.Lock()
+				sink(j.seq, its)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// Acumula los resultados del pool para devolverlos en orden de recorrido.
+// items puede llamarse mientras el pool sigue añadiendo (-flush-interval).
+type collector struct {
+	mu      sync.Mutex
+	results map[int][]IndexItem
+	maxSeq  int
+}
+
+func newCollector() *collector {
+	return &collector{results: map[int][]IndexItem{}, maxSeq: -1}
+}
+
+func (c *collector) add(seq int, items []IndexItem) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.results[seq] = items
+	if seq > c.maxSeq {
+		c.maxSeq = seq
+	}
+}
+
+func (c *collector) items() []IndexItem {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var items []IndexItem
+	for i := 0; i <= c.maxSeq; i++ {
+		items = append(items, c.results[i]...)
+	}
+	return items
+}
+
+// Control de concurrencia AIMD: el límite crece ~1 por cada ventana de
+// éxitos (suma 1/límite por llamada correcta) y se reduce a la mitad con
+// cada rate limit, siempre dentro de [min, max].
+type aimdLimiter struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	limit    float64
+	min, max float64
+	active   int
+}
+
+func newAIMDLimiter(min, max int) *aimdLimiter {
+	if min < 1 {
+		min = 1
+	}
+	if max < min {
+		max = min
+	}
+	l := &aimdLimiter{limit: float64(min), min: float64(min), max: float64(max)}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+func (l *aimdLimiter) acquire(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for l.active >= int(l.limit) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		l.cond.Wait()
+	}
+	l.active++
+	return nil
+}
+
+func (l *aimdLimiter) release(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.active--
+	switch {
+	case errors.Is(err, ErrRateLimited):
+		l.limit /= 2
+		if l.limit < l.min {
+			l.limit = l.min
+		}
+	case err == nil:
+		l.limit += 1 / l.limit
+		if l.limit > l.max {
+			l.limit = l.max
+		}
+	}
+	l.cond.Broadcast()
+}
+
+// Límite actual (entero), para informar al final de la ejecución
+func (l *aimdLimiter) current() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int(l.limit)
+}
+
+// Semáforo por bytes (-max-inflight-bytes): acota la suma de los previews
+// en memoria a la vez. Un preview mayor que el máximo pasa solo si no hay
+// otros en vuelo, para que no se bloquee para siempre.
+type byteSemaphore struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	max  int64
+	used int64
+}
+
+func newByteSemaphore(max int64) *byteSemaphore {
+	b := &byteSemaphore{max: max}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+func (b *byteSemaphore) acquire(n int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for b.used > 0 && b.used+n > b.max {
+		b.cond.Wait()
+	}
+	b.used += n
+}
+
+func (b *byteSemaphore) release(n int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.used -= n
+	b.cond.Broadcast()
+}
+
+// Summarizer que pasa cada llamada por el limitador AIMD
+type adaptiveSummarizer struct {
+	next    Summarizer
+	limiter *aimdLimiter
+}
+
+func (a *adaptiveSummarizer) Summarize(ctx context.Context, model, filename, preview string) (string, []string, error) {
+	if err := a.limiter.acquire(ctx); err != nil {
+		return "", nil, err
+	}
+	sum, kws, err := a.next.Summarize(ctx, model, filename, preview)
+	a.limiter.release(err)
+	return sum, kws, err
+}
+
+func (a *adaptiveSummarizer) Unwrap() Summarizer { return a.next }
+
+// Trabajo retenido hasta el final del recorrido (-order)
+type pendingJob struct {
+	job
+	name string
+	size int64
+	mod  time.Time
+}
+
+// Ordena los trabajos según -order: largest primero equilibra mejor el
+// pool (los largos empiezan pronto), smallest da resultados antes. El
+// orden del índice no cambia: lo fija seq.
+func sortJobs(p []pendingJob, order string) {
+	var less func(a, b pendingJob) bool
+	switch order {
+	case "largest":
+		less = func(a, b pendingJob) bool { return a.size > b.size }
+	case "smallest":
+		less = func(a, b pendingJob) bool { return a.size < b.size }
+	case "name":
+		less = func(a, b pendingJob) bool { return a.name < b.name }
+	case "mtime":
+		less = func(a, b pendingJob) bool { return a.mod.Before(b.mod) }
+	default:
+		return
+	}
+	sort.SliceStable(p, func(i, j int) bool { return less(p[i], p[j]) })
+}
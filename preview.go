@@ -0,0 +1,305 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Transformaciones del preview antes de enviarlo al LLM
+
+var (
+	htmlBlockRe  = regexp.MustCompile(`(?is)<(script|style)\b.*?</(script|style)>|<!--.*?-->`)
+	htmlTagRe    = regexp.MustCompile(`<[a-zA-Z/!][^>]*>`)
+	hSpaceRe     = regexp.MustCompile(`[ \t\r\f\v]+`)
+	blankLinesRe = regexp.MustCompile(`\n\s*\n+`)
+)
+
+// Quita etiquetas HTML (y bloques script/style/comentarios), decodifica
+// entidades y compacta espacios. Sirve también para Markdown con HTML
+// embebido: solo elimina lo que parece una etiqueta.
+func stripHTML(s string) string {
+	s = htmlBlockRe.ReplaceAllString(s, " ")
+	s = htmlTagRe.ReplaceAllString(s, " ")
+	s = html.UnescapeString(s)
+	return collapseSpaces(s)
+}
+
+// Espacios horizontales a uno y líneas en blanco repetidas a una
+func collapseSpaces(s string) string {
+	s = hSpaceRe.ReplaceAllString(s, " ")
+	lines := strings.Split(s, "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimSpace(l)
+	}
+	s = strings.Join(lines, "\n")
+	s = blankLinesRe.ReplaceAllString(s, "\n\n")
+	return strings.TrimSpace(s)
+}
+
+// Separa un bloque de metadatos inicial delimitado por una línea que es
+// exactamente uno de delims (p. ej. "---" ... "---" o "+++" ... "+++")
+func splitFrontmatter(s string, delims []string) (meta, body string, ok bool) {
+	s = strings.TrimPrefix(s, "\uFEFF")
+	first, rest, found := strings.Cut(s, "\n")
+	if !found {
+		return "", s, false
+	}
+	first = strings.TrimSpace(first)
+	for _, d := range delims {
+		if first != d {
+			continue
+		}
+		lines := strings.SplitAfter(rest, "\n")
+		n := 0
+		for _, l := range lines {
+			if strings.TrimSpace(l) == d {
+				return rest[:n], rest[n+len(l):], true
+			}
+			n += len(l)
+		}
+	}
+	return "", s, false
+}
+
+var fmKeyRe = regexp.MustCompile(`^(?i)(keywords|tags)\s*[:=]\s*(.*)$`)
+
+// Keywords/tags declarados en los metadatos: "tags: [a, b]",
+// `tags = ["a", "b"]` o una lista YAML con "- a" en líneas siguientes
+func frontmatterKeywords(meta string) []string {
+	var out []string
+	add := func(v string) {
+		v = strings.ToLower(strings.Trim(strings.TrimSpace(v), `"'`))
+		if v != "" {
+			out = append(out, v)
+		}
+	}
+	lines := strings.Split(meta, "\n")
+	for i := 0; i < len(lines); i++ {
+		m := fmKeyRe.FindStringSubmatch(strings.TrimSpace(lines[i]))
+		if m == nil {
+			continue
+		}
+		if v := strings.TrimSpace(m[2]); v != "" {
+			for _, e := range strings.Split(strings.Trim(v, "[]"), ",") {
+				add(e)
+			}
+			continue
+		}
+		for i+1 < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i+1]), "- ") {
+			i++
+			add(strings.TrimPrefix(strings.TrimSpace(lines[i]), "- "))
+		}
+	}
+	return out
+}
+
+// Añade a kws los elementos de extra que aún no están
+func mergeKeywords(kws, extra []string) []string {
+	seen := map[string]bool{}
+	for _, k := range kws {
+		seen[strings.ToLower(k)] = true
+	}
+	for _, k := range extra {
+		if !seen[strings.ToLower(k)] {
+			seen[strings.ToLower(k)] = true
+			kws = append(kws, k)
+		}
+	}
+	return kws
+}
+
+// Normaliza saltos de línea (\r\n y \r sueltos a \n) y elimina caracteres
+// de control salvo \n y \t. Devuelve si el texto tenía algo raro: control
+// eliminado o finales de línea mezclados. Un archivo todo CRLF no cuenta.
+func sanitizeControl(s string) (string, bool) {
+	if !strings.ContainsFunc(s, func(r rune) bool { return r != '\n' && r != '\t' && unicode.IsControl(r) }) {
+		return s, false
+	}
+	var b strings.Builder
+	removed := false
+	var lf, crlf, cr bool
+	for i, r := range s {
+		switch {
+		case r == '\r':
+			if i+1 < len(s) && s[i+1] == '\n' {
+				crlf = true
+				continue
+			}
+			cr = true
+			b.WriteByte('\n')
+		case r == '\n':
+			if i == 0 || s[i-1] != '\r' {
+				lf = true
+			}
+			b.WriteRune(r)
+		case r == '\t':
+			b.WriteRune(r)
+		case unicode.IsControl(r):
+			removed = true
+		default:
+			b.WriteRune(r)
+		}
+	}
+	mixed := lf && crlf || lf && cr || crlf && cr
+	return b.String(), removed || mixed
+}
+
+// Quita una secuencia UTF-8 incompleta al final (cortada por -max)
+func trimPartialRune(s string) string {
+	for i := len(s) - 1; i >= 0 && i >= len(s)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(s[i]) {
+			if !utf8.FullRuneInString(s[i:]) {
+				return s[:i]
+			}
+			break
+		}
+	}
+	return s
+}
+
+// Lee head bytes del principio y tail del final (con ReadAt, sin leer el
+// medio) unidos por "\n...\n". Si el archivo cabe entero, lo lee tal cual.
+func readHeadTail(r io.ReaderAt, size int64, head, tail int) ([]byte, error) {
+	if size <= int64(head+tail) {
+		b := make([]byte, size)
+		n, err := r.ReadAt(b, 0)
+		if err == io.EOF {
+			err = nil
+		}
+		return b[:n], err
+	}
+	h := make([]byte, head)
+	n, err := r.ReadAt(h, 0)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	t := make([]byte, tail)
+	m, err := r.ReadAt(t, size-int64(tail))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	// Sin runas partidas en los bordes del corte
+	hs := trimPartialRune(string(h[:n]))
+	ts := string(t[:m])
+	for i := 0; i < utf8.UTFMax && len(ts) > 0 && !utf8.RuneStart(ts[0]); i++ {
+		ts = ts[1:]
+	}
+	return []byte(hs + "\n...\n" + ts), nil
+}
+
+// n ventanas repartidas por el archivo que suman unos total bytes, unidas
+// con "\n...\n" (-sample): la primera empieza al principio y la última
+// acaba al final. Con n=1 es una sola ventana en el centro.
+func readSample(r io.ReaderAt, size int64, total, n int) ([]byte, error) {
+	if size <= int64(total) || n < 1 {
+		return readHeadTail(r, size, total, 0)
+	}
+	w := int64(total / n)
+	parts := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		off := (size - w) / 2
+		if n > 1 {
+			off = int64(i) * (size - w) / int64(n-1)
+		}
+		b := make([]byte, w)
+		m, err := r.ReadAt(b, off)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		p := string(b[:m])
+		if off > 0 {
+			for j := 0; j < utf8.UTFMax && len(p) > 0 && !utf8.RuneStart(p[0]); j++ {
+				p = p[1:]
+			}
+		}
+		parts = append(parts, trimPartialRune(p))
+	}
+	return []byte(strings.Join(parts, "\n...\n")), nil
+}
+
+// Últimos n bytes (logs: lo reciente está al final). Si no se lee desde el
+// principio se descarta la primera línea, que casi siempre queda cortada.
+func readTail(r io.ReaderAt, size int64, n int) ([]byte, error) {
+	off := max(size-int64(n), 0)
+	b := make([]byte, size-off)
+	m, err := r.ReadAt(b, off)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	b = b[:m]
+	if off > 0 {
+		if i := bytes.IndexByte(b, '\n'); i >= 0 && i < len(b)-1 {
+			b = b[i+1:]
+		}
+		// Sin línea que descartar: al menos no empezar con una runa partida
+		for i := 0; i < utf8.UTFMax && len(b) > 0 && !utf8.RuneStart(b[0]); i++ {
+			b = b[1:]
+		}
+	}
+	return b, nil
+}
+
+// Antepone "N| " a cada línea (-line-numbers) para que el modelo pueda
+// citar ubicaciones del código
+func numberLines(s string) string {
+	lines := strings.SplitAfter(s, "\n")
+	var b strings.Builder
+	for i, l := range lines {
+		if l == "" {
+			continue // tras el último \n
+		}
+		fmt.Fprintf(&b, "%d| %s", i+1, l)
+	}
+	return b.String()
+}
+
+// Interpreta los bytes como ISO-8859-1 (cada byte es el code point)
+func latin1ToUTF8(s string) string {
+	r := make([]rune, len(s))
+	for i := 0; i < len(s); i++ {
+		r[i] = rune(s[i])
+	}
+	return string(r)
+}
+
+// Colapsa líneas consecutivas idénticas en una sola con " (xN)"
+func dedupLines(s string) string {
+	lines := strings.Split(s, "\n")
+	out := lines[:0]
+	for i := 0; i < len(lines); {
+		j := i + 1
+		for j < len(lines) && lines[j] == lines[i] {
+			j++
+		}
+		if n := j - i; n > 1 {
+			out = append(out, fmt.Sprintf("%s (x%d)", lines[i], n))
+		} else {
+			out = append(out, lines[i])
+		}
+		i = j
+	}
+	return strings.Join(out, "\n")
+}
+
+// Primer encabezado "# Título" de un Markdown (fuera de bloques de
+// código), o "" si no hay
+func markdownTitle(s string) string {
+	inFence := false
+	for _, l := range strings.Split(s, "\n") {
+		l = strings.TrimSpace(l)
+		if strings.HasPrefix(l, "```") || strings.HasPrefix(l, "~~~") {
+			inFence = !inFence
+			continue
+		}
+		if !inFence && strings.HasPrefix(l, "# ") {
+			return strings.TrimSpace(strings.TrimRight(l[2:], "#"))
+		}
+	}
+	return ""
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Flag repetible: cada aparición añade un valor
+type multiFlag []string
+
+func (m *multiFlag) String() string { return strings.Join(*m, " ") }
+
+func (m *multiFlag) Set(v string) error {
+	*m = append(*m, v)
+	return nil
+}
+
+// Interpreta los -preview-cmd ".docx=pandoc -t plain" en extensión →
+// comando (el archivo se añade como último argumento)
+func parsePreviewCmds(specs []string) (map[string][]string, error) {
+	cmds := map[string][]string{}
+	for _, spec := range specs {
+		ext, cmd, ok := strings.Cut(spec, "=")
+		args := strings.Fields(cmd)
+		if !ok || len(args) == 0 || !strings.HasPrefix(ext, ".") {
+			return nil, fmt.Errorf("-preview-cmd %q: se espera .ext=comando", spec)
+		}
+		cmds[strings.ToLower(strings.TrimSpace(ext))] = args
+	}
+	return cmds, nil
+}
+
+// exec.CommandContext que al vencer ctx mata el grupo de procesos del
+// comando y, pasado waitDelay, deja de esperar a que se cierren sus pipes
+func commandContext(ctx context.Context, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	killGroup(cmd)
+	cmd.WaitDelay = waitDelay
+	return cmd
+}
+
+const waitDelay = 2 * time.Second
+
+// Ejecuta el conversor sobre path y devuelve hasta max bytes de su stdout
+// como preview. Lo que pase de max no se lee: se corta el conversor.
+func runPreviewCmd(args []string, path string, max int, timeout time.Duration) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	cmd := commandContext(ctx, args[0], append(args[1:], path)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("preview-cmd %s: %w", args[0], err)
+	}
+	out, rerr := io.ReadAll(io.LimitReader(stdout, int64(max)))
+	truncated := rerr == nil && len(out) == max
+	if truncated {
+		cancel()
+	}
+	err = cmd.Wait()
+	switch {
+	case truncated:
+		return out, nil
+	case ctx.Err() != nil:
+		return nil, wrapTimeout(ctx.Err())
+	case err == nil:
+		err = rerr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("preview-cmd %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
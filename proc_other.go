@@ -0,0 +1,9 @@
+//go:build !unix
+
+package main
+
+import "os/exec"
+
+// Sin grupos de procesos en esta plataforma: se mata solo el hijo directo
+// y WaitDelay evita esperar a los nietos
+func killGroup(cmd *exec.Cmd) {}
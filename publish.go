@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Resumen de una ejecución que acompaña al índice en -publish-dir, para
+// auditarla y poder repetirla
+type Manifest struct {
+	Generated        time.Time         `json:"generated"`
+	GeneratorVersion string            `json:"generator_version,omitempty"`
+	Dir              string            `json:"dir"`
+	Provider         string            `json:"provider"`
+	Model            string            `json:"model"`
+	DurationMs       int64             `json:"duration_ms"`
+	Items            int               `json:"items"`
+	Errors           int               `json:"errors"`
+	ErrorKinds       map[string]int    `json:"error_kinds,omitempty"`
+	Notes            int               `json:"notes"`
+	TokensEstimated  int64             `json:"tokens_estimated"`
+	Reused           int64             `json:"reused"`    // del índice previo
+	LLMCalls         int64             `json:"llm_calls"` // llamadas al proveedor
+	DedupHits        int64             `json:"dedup_hits"`
+	CacheHits        int64             `json:"cache_hits"`
+	Flags            map[string]string `json:"flags"` // flags fijados en la línea de comandos
+	Tags             map[string]string `json:"tags,omitempty"`
+}
+
+// Cuenta ítems, errores y notas del índice en m
+func (m *Manifest) count(items []IndexItem) {
+	m.Items = len(items)
+	for _, it := range items {
+		if it.Error != "" {
+			m.Errors++
+			if m.ErrorKinds == nil {
+				m.ErrorKinds = map[string]int{}
+			}
+			kind := it.ErrorKind
+			if kind == "" {
+				kind = "other"
+			}
+			m.ErrorKinds[kind]++
+		}
+		if it.Note != "" {
+			m.Notes++
+		}
+	}
+}
+
+// Escribe name y su manifiesto (<name sin .json>.manifest.json) en un
+// directorio temporal junto a dir y lo pone en el lugar de dir, así no se
+// ve nunca un índice de una ejecución con el manifiesto de otra. Entre
+// los dos rename hay un instante en que dir no existe.
+func publishDir(dir, name string, idx Index, m Manifest) error {
+	dir = filepath.Clean(dir)
+	if err := os.MkdirAll(filepath.Dir(dir), 0o755); err != nil {
+		return err
+	}
+	tmp := fmt.Sprintf("%s.%d.%d.tmp", dir, os.Getpid(), time.Now().UnixNano())
+	if err := os.Mkdir(tmp, 0o755); err != nil {
+		return err
+	}
+	manifest := strings.TrimSuffix(name, ".json") + ".manifest.json"
+	for file, v := range map[string]any{name: idx, manifest: m} {
+		t, err := writeTemp(filepath.Join(tmp, file), v)
+		if err == nil {
+			err = os.Rename(t, filepath.Join(tmp, file))
+		}
+		if err != nil {
+			os.RemoveAll(tmp)
+			return err
+		}
+	}
+
+	unlock, err := lockFile(dir + ".lock")
+	if err != nil {
+		os.RemoveAll(tmp)
+		return err
+	}
+	defer unlock()
+	old := tmp + ".old"
+	if err := os.Rename(dir, old); err != nil && !os.IsNotExist(err) {
+		os.RemoveAll(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, dir); err != nil {
+		os.Rename(old, dir)
+		os.RemoveAll(tmp)
+		return err
+	}
+	return os.RemoveAll(old)
+}
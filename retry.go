@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// Reintenta rate limits, timeouts de red, respuestas vacías y 5xx con backoff exponencial (-retries).
+// Con jitter cada espera es un valor al azar entre 0 y el backoff ("full
+// jitter"): si muchos workers reciben un 429 a la vez no vuelven todos en
+// el mismo instante. Un Retry-After del proveedor manda sobre el backoff.
+type retrySummarizer struct {
+	next      Summarizer
+	retries   int
+	base, max time.Duration
+	jitter    bool
+	budget    *atomic.Int64 // reintentos que quedan en la ejecución (-retry-budget); nil = sin tope
+}
+
+func (r *retrySummarizer) Summarize(ctx context.Context, model, filename, preview string) (string, []string, error) {
+	for attempt := 0; ; attempt++ {
+		sum, kws, err := r.next.Summarize(ctx, model, filename, preview)
+		// Los reintentos comparten el timeout del archivo: vencido ese plazo
+		// (o cancelada la ejecución) no hay nada que repetir, y no se gasta
+		// -retry-budget
+		if err == nil || attempt >= r.retries || !retryable(err) || ctx.Err() != nil || !r.spend() {
+			return sum, kws, err
+		}
+		t := time.NewTimer(r.delay(attempt, err))
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return sum, kws, err
+		}
+	}
+}
+
+func (r *retrySummarizer) Unwrap() Summarizer { return r.next }
+
+// Consume un reintento del presupuesto compartido; false si ya no quedan
+func (r *retrySummarizer) spend() bool {
+	return r.budget == nil || r.budget.Add(-1) >= 0
+}
+
+// Espera antes del reintento attempt+1
+func (r *retrySummarizer) delay(attempt int, err error) time.Duration {
+	var he *httpError
+	if errors.As(err, &he) {
+		if s, e := strconv.Atoi(he.Header.Get("Retry-After")); e == nil && s >= 0 {
+			return time.Duration(s) * time.Second
+		}
+	}
+	d := r.base << min(attempt, 30)
+	if d <= 0 || d > r.max {
+		d = r.max
+	}
+	if r.jitter {
+		d = rand.N(d + 1)
+	}
+	return d
+}
+
+// Fallos pasajeros que vale la pena repetir
+func retryable(err error) bool {
+	var he *httpError
+	return errors.Is(err, ErrRateLimited) || errors.Is(err, ErrTimeout) || errors.Is(err, ErrEmptyResponse) ||
+		errors.As(err, &he) && he.Status >= 500
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"os"
+	"strings"
+)
+
+// Sufijo de los archivos de metadatos manuales: <archivo>.index.yaml
+const sidecarSuffix = ".index.yaml"
+
+// Valores fijados a mano para un archivo. Summary no vacío evita el LLM;
+// Keywords (si hay) reemplaza las del modelo y ExtraKeywords se añade.
+type sidecar struct {
+	Summary       string
+	Keywords      []string
+	ExtraKeywords []string
+}
+
+// Lee el sidecar de path; (nil, nil) si no existe
+func loadSidecar(path string) (*sidecar, error) {
+	b, err := os.ReadFile(path + sidecarSuffix)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseSidecar(string(b)), nil
+}
+
+// Subconjunto de YAML suficiente para un sidecar:
+//
+//	summary: texto (o "texto", o un bloque con | / >)
+//	keywords: [a, b]   o en líneas siguientes "- a"
+//	extra_keywords: ...
+func parseSidecar(src string) *sidecar {
+	sc := &sidecar{}
+	lines := strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if strings.HasPrefix(strings.TrimSpace(line), "#") || strings.HasPrefix(line, " ") {
+			continue
+		}
+		key, val, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key, val = strings.TrimSpace(key), strings.TrimSpace(val)
+
+		// Continuación: bloque indentado (| o >) o lista "- item"
+		var block []string
+		for i+1 < len(lines) && (strings.HasPrefix(lines[i+1], " ") || strings.HasPrefix(lines[i+1], "\t") || strings.HasPrefix(lines[i+1], "- ")) {
+			i++
+			block = append(block, strings.TrimSpace(lines[i]))
+		}
+
+		switch key {
+		case "summary":
+			switch val {
+			case "|":
+				sc.Summary = strings.TrimSpace(strings.Join(block, "\n"))
+			case ">", "":
+				sc.Summary = strings.TrimSpace(strings.Join(block, " "))
+			default:
+				sc.Summary = unquoteYAML(val)
+			}
+		case "keywords":
+			sc.Keywords = yamlList(val, block)
+		case "extra_keywords":
+			sc.ExtraKeywords = yamlList(val, block)
+		}
+	}
+	return sc
+}
+
+// Lista en estilo flujo ([a, b]) o en bloque ("- a" por línea)
+func yamlList(val string, block []string) []string {
+	var out []string
+	if strings.HasPrefix(val, "[") {
+		for _, e := range strings.Split(strings.Trim(val, "[]"), ",") {
+			if e = unquoteYAML(strings.TrimSpace(e)); e != "" {
+				out = append(out, e)
+			}
+		}
+		return out
+	}
+	for _, l := range block {
+		if e, ok := strings.CutPrefix(l, "- "); ok {
+			if e = unquoteYAML(strings.TrimSpace(e)); e != "" {
+				out = append(out, e)
+			}
+		}
+	}
+	return out
+}
+
+func unquoteYAML(s string) string {
+	if len(s) >= 2 && (s[0] == '"' && s[len(s)-1] == '"' || s[0] == '\'' && s[len(s)-1] == '\'') {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"path"
+	"strings"
+	"time"
+)
+
+// Resumen del corpus indexado (-stats-out), pensado para dashboards
+type CorpusStats struct {
+	Generated       time.Time            `json:"generated"`
+	Dir             string               `json:"dir"`
+	Files           int                  `json:"files"`
+	Bytes           int64                `json:"bytes"`
+	Extensions      map[string]*extStats `json:"extensions"`
+	Errors          int                  `json:"errors"`
+	ErrorRate       float64              `json:"error_rate"` // errores / archivos
+	ErrorKinds      map[string]int       `json:"error_kinds,omitempty"`
+	Notes           int                  `json:"notes"`
+	Summarized      int                  `json:"summarized"`        // ítems con summary
+	AvgSummaryChars float64              `json:"avg_summary_chars"` // entre los que tienen
+	Languages       map[string]int       `json:"languages,omitempty"`
+}
+
+type extStats struct {
+	Files int   `json:"files"`
+	Bytes int64 `json:"bytes"`
+}
+
+// Agrega los ítems del índice. Las entradas de comprimidos cuentan por la
+// extensión de la entrada; lang solo está con -lang-hint.
+func corpusStats(idx Index) CorpusStats {
+	st := CorpusStats{Generated: idx.Generated, Dir: idx.Dir, Extensions: map[string]*extStats{}}
+	chars := 0
+	for _, it := range idx.Items {
+		st.Files++
+		st.Bytes += it.Size
+		ext := strings.ToLower(path.Ext(it.Path))
+		if ext == "" {
+			ext = "(sin extensión)"
+		}
+		if st.Extensions[ext] == nil {
+			st.Extensions[ext] = &extStats{}
+		}
+		st.Extensions[ext].Files++
+		st.Extensions[ext].Bytes += it.Size
+		if it.Error != "" {
+			st.Errors++
+			if st.ErrorKinds == nil {
+				st.ErrorKinds = map[string]int{}
+			}
+			kind := it.ErrorKind
+			if kind == "" {
+				kind = "other"
+			}
+			st.ErrorKinds[kind]++
+		}
+		if it.Note != "" {
+			st.Notes++
+		}
+		if it.Summary != "" {
+			st.Summarized++
+			chars += len([]rune(it.Summary))
+		}
+		if it.Lang != "" {
+			if st.Languages == nil {
+				st.Languages = map[string]int{}
+			}
+			st.Languages[it.Lang]++
+		}
+	}
+	if st.Files > 0 {
+		st.ErrorRate = float64(st.Errors) / float64(st.Files)
+	}
+	if st.Summarized > 0 {
+		st.AvgSummaryChars = float64(chars) / float64(st.Summarized)
+	}
+	return st
+}
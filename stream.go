@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Escritor incremental del índice para -stream: escribe la cabecera, cada
+// ítem a medida que termina y el cierre del array, sin tener todos los
+// ítems en memoria. Como writeJSON, escribe a un temporal y renombra.
+type streamWriter struct {
+	path   string
+	tmp    string
+	f      *os.File
+	w      *bufio.Writer
+	suffix []byte
+	n      int
+}
+
+func newStreamWriter(path string, idx Index) (*streamWriter, error) {
+	// Cabecera y cola salen del propio Index serializado sin ítems, así
+	// cualquier campo nuevo de Index aparece también en modo streaming
+	idx.Items = nil
+	b, err := json.MarshalIndent(idx, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	marker := []byte(`"items": null`)
+	i := bytes.Index(b, marker)
+	if i < 0 {
+		return nil, fmt.Errorf("stream: no se encontró el campo items")
+	}
+	tmp := fmt.Sprintf("%s.%d.%d.tmp", path, os.Getpid(), time.Now().UnixNano())
+	f, err := os.OpenFile(tmp, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o666)
+	if err != nil {
+		return nil, err
+	}
+	sw := &streamWriter{path: path, tmp: tmp, f: f, w: bufio.NewWriter(f), suffix: b[i+len(marker):]}
+	sw.w.Write(b[:i])
+	sw.w.WriteString(`"items": [`)
+	return sw, nil
+}
+
+// Añade un ítem al array (no es seguro para uso concurrente)
+func (sw *streamWriter) write(it IndexItem) error {
+	b, err := json.MarshalIndent(it, "    ", "  ")
+	if err != nil {
+		return err
+	}
+	if sw.n > 0 {
+		sw.w.WriteByte(',')
+	}
+	sw.w.WriteString("\n    ")
+	sw.w.Write(b)
+	sw.n++
+	return nil
+}
+
+// Cierra el array y el objeto y publica el archivo
+func (sw *streamWriter) close() error {
+	if sw.n > 0 {
+		sw.w.WriteString("\n  ")
+	}
+	sw.w.WriteString("]")
+	sw.w.Write(sw.suffix)
+	sw.w.WriteString("\n")
+	if err := sw.w.Flush(); err != nil {
+		sw.abort()
+		return err
+	}
+	if err := sw.f.Close(); err != nil {
+		os.Remove(sw.tmp)
+		return err
+	}
+	unlock, err := lockFile(sw.path + ".lock")
+	if err != nil {
+		os.Remove(sw.tmp)
+		return err
+	}
+	defer unlock()
+	return os.Rename(sw.tmp, sw.path)
+}
+
+// Descarta el temporal
+func (sw *streamWriter) abort() {
+	sw.f.Close()
+	os.Remove(sw.tmp)
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Cuenta tokens de un texto para un modelo concreto
+type Tokenizer interface {
+	CountTokens(string) int
+}
+
+// ~4 caracteres por token: lo que se usa si no hay vocabulario del modelo.
+// Falla bastante con código y escrituras no latinas.
+type heuristicTokenizer struct{}
+
+func (heuristicTokenizer) CountTokens(s string) int {
+	return (utf8.RuneCountInString(s) + 3) / 4
+}
+
+// BPE compatible con tiktoken: pre-tokeniza con la regex de la codificación
+// y fusiona cada trozo por rangos. ranks viene del archivo .tiktoken.
+type bpeTokenizer struct {
+	ranks map[string]int
+	pat   *regexp.Regexp
+}
+
+// Regex de pre-tokenización de cada codificación, sin la alternativa final
+// \s+(?!\S)|\s+: Go no tiene lookahead, así que esa se resuelve a mano en
+// pieces cuando ninguna de estas casa
+var bpePatterns = map[string]*regexp.Regexp{
+	"cl100k_base": regexp.MustCompile(`^(?:(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+)`),
+	"o200k_base":  regexp.MustCompile(`^(?:[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]*[\p{Ll}\p{Lm}\p{Lo}\p{M}]+(?i:'s|'t|'re|'ve|'m|'ll|'d)?|[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]+[\p{Ll}\p{Lm}\p{Lo}\p{M}]*(?i:'s|'t|'re|'ve|'m|'ll|'d)?|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n/]*|\s*[\r\n]+)`),
+}
+
+var leadingSpace = regexp.MustCompile(`^\s+`)
+
+func (t *bpeTokenizer) CountTokens(s string) int {
+	n := 0
+	for _, p := range t.pieces(s) {
+		n += t.pieceTokens(p)
+	}
+	return n
+}
+
+// Trozos de la pre-tokenización, en orden
+func (t *bpeTokenizer) pieces(s string) []string {
+	var out []string
+	for s != "" {
+		end := 0
+		if loc := t.pat.FindStringIndex(s); loc != nil {
+			end = loc[1]
+		} else if loc := leadingSpace.FindStringIndex(s); loc != nil {
+			// \s+(?!\S): un bloque de espacios deja el último para la
+			// palabra que sigue
+			end = loc[1]
+			if _, size := utf8.DecodeLastRuneInString(s[:end]); end < len(s) && size < end {
+				end -= size
+			}
+		}
+		if end == 0 {
+			// No debería pasar: el resto va como bytes sueltos
+			for i := range len(s) {
+				out = append(out, s[i:i+1])
+			}
+			return out
+		}
+		out = append(out, s[:end])
+		s = s[end:]
+	}
+	return out
+}
+
+// Fusión por pares de tiktoken: se une siempre el par de menor rango
+// hasta que ningún par adyacente está en el vocabulario
+func (t *bpeTokenizer) pieceTokens(p string) int {
+	if _, ok := t.ranks[p]; ok {
+		return 1
+	}
+	b := make([]int, len(p)+1)
+	for i := range b {
+		b[i] = i
+	}
+	for len(b) > 2 {
+		best, at := -1, -1
+		for i := 0; i+2 < len(b); i++ {
+			if r, ok := t.ranks[p[b[i]:b[i+2]]]; ok && (best < 0 || r < best) {
+				best, at = r, i
+			}
+		}
+		if at < 0 {
+			break
+		}
+		b = append(b[:at+1], b[at+2:]...)
+	}
+	return len(b) - 1
+}
+
+// Codificación de cada familia de modelos de OpenAI; el orden importa
+// (gpt-4o antes que gpt-4)
+var modelEncodings = []struct{ prefix, encoding string }{
+	{"gpt-4o", "o200k_base"},
+	{"gpt-4.1", "o200k_base"},
+	{"gpt-5", "o200k_base"},
+	{"o1", "o200k_base"},
+	{"o3", "o200k_base"},
+	{"o4", "o200k_base"},
+	{"gpt-4", "cl100k_base"},
+	{"gpt-3.5", "cl100k_base"},
+	{"text-embedding-3", "cl100k_base"},
+	{"text-embedding-ada-002", "cl100k_base"},
+}
+
+func encodingFor(model string) string {
+	for _, m := range modelEncodings {
+		if strings.HasPrefix(model, m.prefix) {
+			return m.encoding
+		}
+	}
+	return ""
+}
+
+// Directorio con <codificación>.tiktoken (-tokenizer-dir); vacío = siempre
+// la heurística
+var tokenizerDir string
+
+var (
+	tokenizersMu sync.Mutex
+	tokenizers   = map[string]Tokenizer{}
+)
+
+// Tokenizer para model: BPE si el modelo es conocido y su vocabulario está
+// en tokenizerDir, si no la heurística. Cada vocabulario se carga una vez.
+func tokenizerFor(model string) Tokenizer {
+	enc := encodingFor(model)
+	if enc == "" || tokenizerDir == "" {
+		return heuristicTokenizer{}
+	}
+	tokenizersMu.Lock()
+	defer tokenizersMu.Unlock()
+	if t, ok := tokenizers[enc]; ok {
+		return t
+	}
+	var t Tokenizer = heuristicTokenizer{}
+	if ranks, err := loadRanks(filepath.Join(tokenizerDir, enc+".tiktoken")); err == nil {
+		t = &bpeTokenizer{ranks: ranks, pat: bpePatterns[enc]}
+	}
+	tokenizers[enc] = t
+	return t
+}
+
+// Formato .tiktoken: "<token en base64> <rango>" por línea
+func loadRanks(path string) (map[string]int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	ranks := map[string]int{}
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		tok, rank, ok := strings.Cut(sc.Text(), " ")
+		if !ok {
+			continue
+		}
+		b, err := base64.StdEncoding.DecodeString(tok)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+		r, err := strconv.Atoi(rank)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+		ranks[string(b)] = r
+	}
+	return ranks, sc.Err()
+}
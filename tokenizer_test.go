@@ -0,0 +1,59 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestBPEPieces(t *testing.T) {
+	tests := []struct {
+		enc, in string
+		want    []string
+	}{
+		{"cl100k_base", "hello world", []string{"hello", " world"}},
+		{"cl100k_base", "\n\nfoo", []string{"\n\n", "foo"}},
+		{"cl100k_base", "a  \n\nb", []string{"a", "  \n\n", "b"}},
+		{"cl100k_base", "a   b", []string{"a", "  ", " b"}},
+		{"cl100k_base", "a \tb  ", []string{"a", " ", "\tb", "  "}},
+		{"cl100k_base", "x = 12345;\n", []string{"x", " =", " ", "123", "45", ";\n"}},
+		{"o200k_base", "\n\nfoo", []string{"\n\n", "foo"}},
+		{"o200k_base", "HelloWorld  it's", []string{"Hello", "World", " ", " it's"}},
+		{"o200k_base", "a/b\n", []string{"a", "/b", "\n"}},
+	}
+	for _, tt := range tests {
+		tok := &bpeTokenizer{pat: bpePatterns[tt.enc]}
+		if got := tok.pieces(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s %q: %q, se esperaba %q", tt.enc, tt.in, got, tt.want)
+		}
+	}
+}
+
+// Conteos de tiktoken; necesita los .tiktoken en $TIKTOKEN_DIR
+func TestBPECounts(t *testing.T) {
+	dir := os.Getenv("TIKTOKEN_DIR")
+	if dir == "" {
+		t.Skip("TIKTOKEN_DIR no definido")
+	}
+	tests := []struct {
+		enc, in string
+		want    int
+	}{
+		{"cl100k_base", "hello world", 2},
+		{"cl100k_base", "\n\nfoo", 2},
+		{"cl100k_base", "tiktoken is great!", 6},
+		{"o200k_base", "hello world", 2},
+		{"o200k_base", "\n\nfoo", 2},
+	}
+	for _, tt := range tests {
+		ranks, err := loadRanks(filepath.Join(dir, tt.enc+".tiktoken"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tok := &bpeTokenizer{ranks: ranks, pat: bpePatterns[tt.enc]}
+		if got := tok.CountTokens(tt.in); got != tt.want {
+			t.Errorf("%s %q: %d tokens, se esperaban %d", tt.enc, tt.in, got, tt.want)
+		}
+	}
+}
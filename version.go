@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"runtime/debug"
+	"strings"
+)
+
+// Se fijan al compilar (ver Makefile):
+//
+//	go build -ldflags "-X main.version=v1.2.0 -X main.commit=abc1234 -X main.buildDate=2024-05-01"
+//
+// Si no, se toman del build info de Go (vcs.revision / vcs.time).
+var (
+	version   = "dev"
+	commit    = ""
+	buildDate = ""
+)
+
+func init() {
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return
+	}
+	if version == "dev" && bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+		version = bi.Main.Version
+	}
+	for _, s := range bi.Settings {
+		switch {
+		case s.Key == "vcs.revision" && commit == "":
+			commit = s.Value
+		case s.Key == "vcs.time" && buildDate == "":
+			buildDate = s.Value
+		}
+	}
+	if len(commit) > 12 {
+		commit = commit[:12]
+	}
+}
+
+// Versión que se guarda en Index.GeneratorVersion
+func generatorVersion() string {
+	// Las pseudo-versiones de Go ya llevan el commit
+	if commit == "" || strings.Contains(version, commit) {
+		return version
+	}
+	return version + "+" + commit
+}
+
+func printVersion() {
+	fmt.Println("text-indexer", version)
+	if commit != "" {
+		fmt.Println("commit:", commit)
+	}
+	if buildDate != "" {
+		fmt.Println("build:", buildDate)
+	}
+}
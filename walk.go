@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Listado de un directorio que se lee por adelantado
+type dirListing struct {
+	entries []fs.DirEntry
+	err     error
+	done    chan struct{}
+}
+
+// Como filepath.WalkDir (mismo orden, mismas llamadas a fn, SkipDir y
+// SkipAll), pero los subdirectorios se listan por adelantado con hasta n
+// lecturas a la vez (-walk-concurrency). fn se sigue llamando en serie y en
+// orden, así que seq y -resume-from no cambian; lo que se solapa son las
+// lecturas lentas de directorios en NFS o sistemas sobre S3.
+func walkDirParallel(root string, n int, fn fs.WalkDirFunc) error {
+	sem := make(chan struct{}, n)
+	list := func(dir string) *dirListing {
+		l := &dirListing{done: make(chan struct{})}
+		go func() {
+			sem <- struct{}{}
+			l.entries, l.err = os.ReadDir(dir)
+			<-sem
+			close(l.done)
+		}()
+		return l
+	}
+
+	info, err := os.Lstat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		var l *dirListing
+		if info.IsDir() {
+			l = list(root)
+		}
+		err = walkListed(root, fs.FileInfoToDirEntry(info), l, fn, list)
+	}
+	if errors.Is(err, filepath.SkipDir) || errors.Is(err, filepath.SkipAll) {
+		return nil
+	}
+	return err
+}
+
+func walkListed(path string, d fs.DirEntry, l *dirListing, fn fs.WalkDirFunc, list func(string) *dirListing) error {
+	if err := fn(path, d, nil); err != nil || !d.IsDir() {
+		if err == filepath.SkipDir && d.IsDir() {
+			err = nil
+		}
+		return err
+	}
+	<-l.done
+	if l.err != nil {
+		if err := fn(path, d, l.err); err != nil {
+			if err == filepath.SkipDir {
+				err = nil
+			}
+			return err
+		}
+	}
+	// Los subdirectorios de este nivel empiezan a leerse ya, mientras se
+	// procesan los anteriores
+	subs := make([]*dirListing, len(l.entries))
+	for i, e := range l.entries {
+		if e.IsDir() {
+			subs[i] = list(filepath.Join(path, e.Name()))
+		}
+	}
+	for i, e := range l.entries {
+		if err := walkListed(filepath.Join(path, e.Name()), e, subs[i], fn, list); err != nil {
+			if err == filepath.SkipDir {
+				break
+			}
+			return err
+		}
+	}
+	return nil
+}